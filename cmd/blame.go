@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	blameSummary bool
+	blameCmd     = &cobra.Command{
+		Use:   "blame <path>[@revision]",
+		Short: "Show who last changed each line of a file, or who owns the lines under a path",
+		Long: `Show, for each line of a file at a revision (default HEAD), the commit that
+last changed it and its author, like git blame.
+
+With --summary, path may also be a directory, or the repository root for the
+whole tree, and the lines surviving at the revision are totalled per author
+instead. Authors are mapped through the repository's .mailmap, and binary
+files are skipped. Blames are cached as for grit count ownership; --no-cache
+blames every file afresh.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runBlame,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(blameCmd)
+	blameCmd.Flags().BoolVar(&blameSummary, "summary", false, "Total the surviving lines per author over a file, a directory or the whole tree")
+	blameCmd.Flags().StringVarP(&remoteName, "remote", "r", "", "Remote name to use for branch references")
+	blameCmd.Flags().BoolVarP(&noCache, "no-cache", "n", false, "With --summary, blame every file afresh, without reading or saving cached blames")
+}
+
+// blameTarget is a path in a repository at a revision, as given to grit blame
+type blameTarget struct {
+	root    string // root of the repository's working tree
+	commit  *object.Commit
+	path    string // relative to root, with slashes; "." for the whole tree
+	mailmap *mailmap
+}
+
+// openBlameTarget finds the repository a path[@revision] argument lies in
+// and the commit the revision names, HEAD by default
+func openBlameTarget(arg string) (*blameTarget, error) {
+	spec := parseRevisionSpec(arg)
+	abs, err := filepath.Abs(spec.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The path may not exist in the working tree at all if it is blamed at
+	// another revision, so look for the repository from its directory
+	start := abs
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		start = filepath.Dir(abs)
+	}
+	repo, err := git.PlainOpenWithOptions(start, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening repository for %s: %w", spec.Path, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("opening working tree for %s: %w", spec.Path, err)
+	}
+	root := worktree.Filesystem.Root()
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside the repository at %s", spec.Path, root)
+	}
+
+	ref, err := revisionSpec{Path: root, Branch: spec.Branch}.resolve(repo, remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("resolving revision for %s: %w", spec, err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return &blameTarget{
+		root:    root,
+		commit:  commit,
+		path:    filepath.ToSlash(rel),
+		mailmap: readMailmap(repo, root, commit),
+	}, nil
+}
+
+func runBlame(cmd *cobra.Command, args []string) {
+	target, err := openBlameTarget(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if blameSummary {
+		files, err := treeFiles(target.commit, func(name string) bool {
+			return pathspecMatches(target.path, name)
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if len(files) == 0 {
+			fmt.Printf("Error: no text files at %s in %s\n", target.path, target.commit.Hash.String()[:7])
+			return
+		}
+
+		blame, err := newFileBlamer(blameStore(), target.commit, files)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		owners := lineOwners{}
+		for _, file := range files {
+			fileOwners, err := blame(file)
+			if err != nil {
+				fmt.Printf("Error blaming %s: %v\n", file.Name, err)
+				continue
+			}
+			owners.addFile(fileOwners, target.mailmap)
+		}
+		printLineOwners(owners.sorted())
+		return
+	}
+
+	if _, err := target.commit.File(target.path); err != nil {
+		fmt.Printf("Error: %s is not a file in %s (use --summary for directories)\n", target.path, target.commit.Hash.String()[:7])
+		return
+	}
+	result, err := git.Blame(target.commit, target.path)
+	if err != nil {
+		fmt.Printf("Error blaming %s: %v\n", target.path, err)
+		return
+	}
+	printBlame(result, target.mailmap)
+}
+
+// treeFiles returns the text files of a commit's tree for which keep returns
+// true, in tree order
+func treeFiles(c *object.Commit, keep func(name string) bool) ([]*object.File, error) {
+	files, err := c.Files()
+	if err != nil {
+		return nil, err
+	}
+	var kept []*object.File
+	err = files.ForEach(func(f *object.File) error {
+		if !keep(f.Name) {
+			return nil
+		}
+		binary, err := f.IsBinary()
+		if err != nil || binary {
+			return err
+		}
+		kept = append(kept, f)
+		return nil
+	})
+	return kept, err
+}
+
+// printBlame writes each line of a blamed file with the commit that last
+// changed it, its author and its date
+func printBlame(result *git.BlameResult, m *mailmap) {
+	color := colorEnabled()
+	names := make([]string, len(result.Lines))
+	nameWidth := 0
+	for i, line := range result.Lines {
+		names[i] = m.resolve(object.Signature{Name: line.AuthorName, Email: line.Author}).Name
+		nameWidth = max(nameWidth, len(names[i]))
+	}
+	numberWidth := len(strconv.Itoa(len(result.Lines)))
+
+	for i, line := range result.Lines {
+		fmt.Printf("%s (%s %s %*d) %s\n",
+			colorize(line.Hash.String()[:7], colorYellow, color),
+			colorize(fmt.Sprintf("%-*s", nameWidth, names[i]), colorCyan, color),
+			line.Date.Format(time.DateOnly),
+			numberWidth, i+1,
+			line.Text)
+	}
+}
+
+// authorLines is the number of surviving lines an author last changed
+type authorLines struct {
+	Author string
+	Lines  int
+	Files  int // files with at least one of the author's lines
+}
+
+// lineOwners tallies surviving lines per author
+type lineOwners map[string]*authorLines
+
+// addFile counts the lines of one blamed file, mapping their authors through
+// the mailmap
+func (o lineOwners) addFile(owners []blameOwner, m *mailmap) {
+	seen := make(map[string]bool)
+	for _, fileOwner := range owners {
+		author := authorKey(m.resolve(object.Signature{Name: fileOwner.Name, Email: fileOwner.Email}))
+		owner, ok := o[author]
+		if !ok {
+			owner = &authorLines{Author: author}
+			o[author] = owner
+		}
+		owner.Lines += fileOwner.Lines
+		if !seen[author] {
+			seen[author] = true
+			owner.Files++
+		}
+	}
+}
+
+// sorted returns the authors with the most lines first
+func (o lineOwners) sorted() []authorLines {
+	owners := make([]authorLines, 0, len(o))
+	for _, owner := range o {
+		owners = append(owners, *owner)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].Lines != owners[j].Lines {
+			return owners[i].Lines > owners[j].Lines
+		}
+		return owners[i].Author < owners[j].Author
+	})
+	return owners
+}
+
+// printLineOwners writes each author's surviving lines and share of them
+func printLineOwners(owners []authorLines) {
+	total := 0
+	for _, owner := range owners {
+		total += owner.Lines
+	}
+
+	columns := []tableColumn{
+		{header: "Lines", right: true},
+		{header: "Share", right: true},
+		{header: "Files", right: true},
+		{header: "Author", color: colorCyan},
+	}
+	rows := make([][]string, 0, len(owners))
+	for _, owner := range owners {
+		rows = append(rows, []string{
+			strconv.Itoa(owner.Lines),
+			fmt.Sprintf("%.1f%%", 100*float64(owner.Lines)/float64(max(total, 1))),
+			strconv.Itoa(owner.Files),
+			owner.Author,
+		})
+	}
+	writeTable(os.Stdout, columns, rows, colorEnabled())
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBlame(t *testing.T) {
+	t.Setenv(cacheDirEnv, t.TempDir())
+	dir := setupPickaxeRepo(t, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC))
+	defer func() {
+		blameSummary = false
+		noCache = false
+	}()
+
+	// Each line is attributed to the commit that last changed it
+	output := captureStdout(func() { runBlame(nil, []string{filepath.Join(dir, "api.go")}) })
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	assert.Len(t, lines, 3)
+	for i, want := range []string{
+		"(Alice 2024-01-02 1) newAPI()",
+		"(Carol 2024-01-02 2) z := oldAPI()",
+		"(Bob   2024-01-02 3) y := 1",
+	} {
+		assert.Equal(t, want, lines[i][8:])
+	}
+
+	// At an older revision
+	output = captureStdout(func() { runBlame(nil, []string{filepath.Join(dir, "api.go") + "@HEAD~2"}) })
+	assert.Equal(t, 3, strings.Count(output, "(Alice 2024-01-02 "))
+
+	// Directories need --summary
+	output = captureStdout(func() { runBlame(nil, []string{dir}) })
+	assert.Contains(t, output, "Error: . is not a file in ")
+
+	// Surviving lines are totalled per author, through the mailmap
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, mailmapFileName), []byte("Alice <alice@example.com> <carol@example.com>\n"), 0644))
+	blameSummary = true
+	output = captureStdout(func() { runBlame(nil, []string{dir}) })
+	assert.Equal(t, ""+
+		"Lines  Share  Files  Author\n"+
+		"    2  66.7%      1  Alice <alice@example.com>\n"+
+		"    1  33.3%      1  Bob <bob@example.com>\n", output)
+
+	// The blame was cached, unless --no-cache is given
+	store, err := openCacheStore()
+	assert.NoError(t, err)
+	keys, err := store.Keys(blameBucket)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.NoError(t, clearBlames())
+	noCache = true
+	assert.Equal(t, output, captureStdout(func() { runBlame(nil, []string{dir}) }))
+	keys, err = store.Keys(blameBucket)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	output = captureStdout(func() { runBlame(nil, []string{filepath.Join(dir, "missing")}) })
+	assert.Contains(t, output, "Error: no text files at missing in ")
+}
+
+func TestLastChanges(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	// A feature branch changing b.txt, merged after master changed a.txt,
+	// then c.txt changed on master
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	commitFiles(t, dir, worktree, map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n", "d.txt": "d\n"}, "Base", when)
+	feature := plumbing.NewBranchReferenceName("feature")
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: feature, Create: true}))
+	commitFiles(t, dir, worktree, map[string]string{"b.txt": "b2\n"}, "Feature", when.Add(time.Hour))
+	featureHead, err := repo.Head()
+	assert.NoError(t, err)
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}))
+	commitFiles(t, dir, worktree, map[string]string{"a.txt": "a2\n"}, "Main", when.Add(2*time.Hour))
+	mainHead, err := repo.Head()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b2\n"), 0644))
+	_, err = worktree.Add("b.txt")
+	assert.NoError(t, err)
+	_, err = worktree.Commit("Merge feature", &git.CommitOptions{
+		Author:  &object.Signature{Name: "Test Author", Email: "test@example.com", When: when.Add(3 * time.Hour)},
+		Parents: []plumbing.Hash{mainHead.Hash(), featureHead.Hash()},
+	})
+	assert.NoError(t, err)
+	commitFiles(t, dir, worktree, map[string]string{"c.txt": "c2\n"}, "After", when.Add(4*time.Hour))
+
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	assert.NoError(t, err)
+	last, err := lastChanges(nil, commit, []string{"a.txt", "b.txt", "c.txt", "d.txt"})
+	assert.NoError(t, err)
+
+	// Files that differ between the merge's parents were last changed by the
+	// merge, as blame looks down both sides of it
+	messages := make(map[string]string)
+	for path, hash := range last {
+		c, err := repo.CommitObject(hash)
+		assert.NoError(t, err)
+		messages[path] = c.Message
+	}
+	assert.Equal(t, map[string]string{
+		"a.txt": "Merge feature",
+		"b.txt": "Merge feature",
+		"c.txt": "After",
+		"d.txt": "Base",
+	}, messages)
+}
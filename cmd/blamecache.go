@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// blameBucket holds who last changed the lines of individual files, keyed by
+// a file's path and the commit it last changed in (see lastChanges). Nothing
+// between that commit and a later one touches the file, so blaming it at
+// either gives the same result, and ownership of a new revision only needs
+// the files changed since an earlier one blamed.
+const blameBucket = "blame"
+
+// lastChangesBucket holds, for each revision ownership has been worked out
+// at, the commit each of its files last changed in, keyed by commit hash
+const lastChangesBucket = "lastchange"
+
+// blameOwner is an identity, as committed, and the number of lines of a
+// file it last changed. The mailmap is applied later, so that changing it
+// doesn't invalidate the cache.
+type blameOwner struct {
+	Name  string
+	Email string
+	Lines int
+}
+
+// fileBlamer blames a file of the commit it was made for
+type fileBlamer func(f *object.File) ([]blameOwner, error)
+
+// blameOwners blames a file of a commit and tallies its lines per identity,
+// in order of first appearance
+func blameOwners(c *object.Commit, f *object.File) ([]blameOwner, error) {
+	result, err := git.Blame(c, f.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []blameOwner
+	index := make(map[[2]string]int)
+	for _, line := range result.Lines {
+		id := [2]string{line.AuthorName, line.Author}
+		i, ok := index[id]
+		if !ok {
+			i = len(owners)
+			index[id] = i
+			owners = append(owners, blameOwner{Name: line.AuthorName, Email: line.Author})
+		}
+		owners[i].Lines++
+	}
+	return owners, nil
+}
+
+// lastChanges finds, for each path, the newest commit following first parents
+// back from c in which the file differs from any of the commit's parents, or
+// the root commit if there is none. Blame follows every parent of a merge, so
+// a merge bringing in another version of the file counts as a change, but the
+// commits after the one found leave the file and its history alone.
+//
+// With a store, what is found is saved for c, and the walk stops at commits
+// saved by earlier runs, so a run at a revision seen before walks no history
+// and one at a later revision only walks back to it.
+func lastChanges(store kvStore, c *object.Commit, paths []string) (map[string]plumbing.Hash, error) {
+	pending := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		pending[path] = true
+	}
+
+	last := make(map[string]plumbing.Hash, len(paths))
+	saved := loadLastChanges(store, c.Hash)
+	for len(pending) > 0 {
+		// Take whatever an earlier run from here found
+		known := saved
+		if c.Hash.String() != saved.revision {
+			known = loadLastChanges(store, c.Hash)
+		}
+		for path, hash := range known.changes {
+			if pending[path] {
+				delete(pending, path)
+				last[path] = hash
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		tree, err := c.Tree()
+		if err != nil {
+			return nil, err
+		}
+		var first *object.Commit
+		err = c.Parents().ForEach(func(parent *object.Commit) error {
+			if first == nil {
+				first = parent
+			}
+			parentTree, err := parent.Tree()
+			if err != nil {
+				return err
+			}
+			changes, err := object.DiffTree(parentTree, tree)
+			if err != nil {
+				return err
+			}
+			for _, change := range changes {
+				for _, name := range []string{change.From.Name, change.To.Name} {
+					if pending[name] {
+						delete(pending, name)
+						last[name] = c.Hash
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if first == nil {
+			// The root commit added whatever is left
+			for path := range pending {
+				last[path] = c.Hash
+			}
+			break
+		}
+		c = first
+	}
+
+	// Keep what earlier runs found for other paths too
+	if store != nil && len(last) > 0 {
+		changes := make(map[string]plumbing.Hash, len(saved.changes)+len(last))
+		for path, hash := range saved.changes {
+			changes[path] = hash
+		}
+		for path, hash := range last {
+			changes[path] = hash
+		}
+		if len(changes) > len(saved.changes) {
+			saveLastChanges(store, saved.revision, changes)
+		}
+	}
+	return last, nil
+}
+
+// savedLastChanges is what lastChanges found at a revision
+type savedLastChanges struct {
+	revision string
+	changes  map[string]plumbing.Hash
+}
+
+// loadLastChanges reads what lastChanges found at a revision, which is empty
+// if there is no store or nothing was saved
+func loadLastChanges(store kvStore, revision plumbing.Hash) savedLastChanges {
+	saved := savedLastChanges{revision: revision.String()}
+	if store == nil {
+		return saved
+	}
+	data, err := store.Get(lastChangesBucket, saved.revision)
+	if err != nil || data == nil {
+		return saved
+	}
+	var changes map[string]string
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return saved
+	}
+	saved.changes = make(map[string]plumbing.Hash, len(changes))
+	for path, hash := range changes {
+		saved.changes[path] = plumbing.NewHash(hash)
+	}
+	return saved
+}
+
+// saveLastChanges saves what lastChanges found at a revision. Failing to
+// save it only loses the optimisation, so it is not reported.
+func saveLastChanges(store kvStore, revision string, changes map[string]plumbing.Hash) {
+	data := make(map[string]string, len(changes))
+	for path, hash := range changes {
+		data[path] = hash.String()
+	}
+	if encoded, err := json.Marshal(data); err == nil {
+		store.Put(lastChangesBucket, revision, encoded)
+	}
+}
+
+// blameKey is the cache key of a file's path and the commit it last changed in
+func blameKey(changed plumbing.Hash, path string) string {
+	sum := sha256.Sum256([]byte(changed.String() + "\x00" + path))
+	return hex.EncodeToString(sum[:])
+}
+
+// newFileBlamer returns a function that blames files of c. With a store,
+// blames are read from and saved to it, keyed by the commit each file last
+// changed in, which is found for all of files at once. Failing to store a
+// blame only loses the optimisation, so it is not reported.
+func newFileBlamer(store kvStore, c *object.Commit, files []*object.File) (fileBlamer, error) {
+	if store == nil {
+		return func(f *object.File) ([]blameOwner, error) { return blameOwners(c, f) }, nil
+	}
+
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Name
+	}
+	last, err := lastChanges(store, c, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(f *object.File) ([]blameOwner, error) {
+		changed, ok := last[f.Name]
+		if !ok {
+			return blameOwners(c, f)
+		}
+		key := blameKey(changed, f.Name)
+		if data, err := store.Get(blameBucket, key); err == nil && data != nil {
+			var owners []blameOwner
+			if err := json.Unmarshal(data, &owners); err == nil {
+				return owners, nil
+			}
+		}
+
+		owners, err := blameOwners(c, f)
+		if err != nil {
+			return nil, err
+		}
+		if data, err := json.Marshal(owners); err == nil {
+			store.Put(blameBucket, key, data)
+		}
+		return owners, nil
+	}, nil
+}
+
+// blameStore returns the store to cache blames in, or nil if --no-cache was
+// given or the cache can't be opened
+func blameStore() kvStore {
+	if noCache {
+		return nil
+	}
+	store, err := openCacheStore()
+	if err != nil {
+		return nil
+	}
+	return store
+}
+
+// clearBlames removes every cached blame, and the last changes they are
+// keyed by
+func clearBlames() error {
+	if err := clearBucket(blameBucket); err != nil {
+		return err
+	}
+	return clearBucket(lastChangesBucket)
+}
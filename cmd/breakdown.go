@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var groupBy string
+
+// GroupResult holds the lines and commits attributed to one group of a breakdown
+type GroupResult struct {
+	Key     string
+	Added   int64
+	Deleted int64
+	Commits int
+	// Breaking counts the commits marked as breaking changes, in a
+	// breakdown by type
+	Breaking int `json:",omitempty"`
+}
+
+// breakdown accumulates results per group, keyed by group name
+type breakdown map[string]*GroupResult
+
+// add attributes a commit's lines to a group, returning the group
+func (b breakdown) add(key string, added, deleted int64) *GroupResult {
+	group, ok := b[key]
+	if !ok {
+		group = &GroupResult{Key: key}
+		b[key] = group
+	}
+	group.Added += added
+	group.Deleted += deleted
+	group.Commits++
+	return group
+}
+
+// sorted returns the groups ordered by total lines changed, largest first
+func (b breakdown) sorted() []GroupResult {
+	groups := make([]GroupResult, 0, len(b))
+	for _, group := range b {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		li := groups[i].Added + groups[i].Deleted
+		lj := groups[j].Added + groups[j].Deleted
+		if li != lj {
+			return li > lj
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// validateGroupBy checks that by names a breakdown grit knows about
+func validateGroupBy(by string) error {
+	switch by {
+	case "", "author", "type", "scope", "issue":
+		return nil
+	}
+	return fmt.Errorf("invalid breakdown %q (must be author, type, scope or issue)", by)
+}
+
+// authorKey formats a signature as a breakdown key
+func authorKey(sig object.Signature) string {
+	if sig.Email == "" {
+		return sig.Name
+	}
+	return fmt.Sprintf("%s <%s>", sig.Name, sig.Email)
+}
+
+// printResults prints the totals, followed by the breakdown if one was
+// requested. Stale results are marked with a trailing '*'.
+func printResults(results CacheResults, stale bool) {
+	marker := ""
+	if stale {
+		marker = "*"
+	}
+
+	color := colorEnabled()
+	if groupBy == "" {
+		fmt.Printf("%s%s", colorCounts(results.Added, results.Deleted, color), marker)
+		return
+	}
+
+	fmt.Printf("%s%s\n", colorCounts(results.Added, results.Deleted, color), marker)
+	// Every cell in a column gets the same colour codes, so they don't
+	// upset the alignment
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, group := range results.Groups {
+		breaking := ""
+		if group.Breaking > 0 {
+			breaking = fmt.Sprintf(", %s", colorize(fmt.Sprintf("%d breaking", group.Breaking), colorRed, color))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d commit(s)%s\n", colorize(group.Key, colorCyan, color),
+			colorCounts(group.Added, group.Deleted, color), group.Commits, breaking)
+	}
+	w.Flush()
+
+	if len(results.Untracked) > 0 {
+		fmt.Printf("\nCommits without an issue key:\n")
+		for _, summary := range results.Untracked {
+			fmt.Printf("    %s\n", summary)
+		}
+	}
+}
@@ -1,153 +1,429 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/go-git/go-git/v5"
 )
 
+// CacheArgs holds the command-line arguments that determine a cached result.
+// Adding a field changes every cache key; see cacheMigrations.
+type CacheArgs struct {
+	AuthorRegex      string
+	Authors          []string
+	CommitterRegex   string
+	ExcludeAuthors   []string
+	ExcludeBots      bool
+	RemoteName       string
+	FilenamesRegex   string
+	WeekToDate       bool
+	DateField        string
+	CoauthorCredit   string
+	CoauthorTrailers []string
+	GroupBy          string
+	Grep             []string
+	InvertGrep       bool
+	IssueRegex       string
+	Pathspecs        []string
+	Pickaxe          string
+	PickaxeRegex     string
+	Follow           string
+}
+
+// CacheResults holds the totals computed for a cache entry
+type CacheResults struct {
+	Added     int64
+	Deleted   int64
+	Groups    []GroupResult `json:",omitempty"`
+	Untracked []string      `json:",omitempty"` // commits without an issue key
+}
+
 // CacheEntry represents a single cached result
 type CacheEntry struct {
-	Args struct {
-		AuthorRegex    string
-		RemoteName     string
-		FilenamesRegex string
-		WeekToDate     bool
-	}
+	Version    int // cacheSchemaVersion the entry was written with
+	Args       CacheArgs
 	Paths      []string
-	HeadHashes map[string]string // path -> commit hash
-	Results    struct {
-		Added   int64
-		Deleted int64
-	}
-	Timestamp time.Time
+	HeadHashes map[string]string // path spec -> commit hash it resolved to
+	Results    CacheResults
+	Timestamp  time.Time // timeNow when the result was computed
+	// WindowStart and WindowEnd bound the time window the result was counted
+	// over; the entry is only valid while timeNow falls inside it. Both are
+	// zero for --follow, which counts a file's whole history.
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Rejected    string `json:",omitempty"` // why the entry this one replaced was found invalid
+}
+
+// CacheStats counts how often cached results were used
+type CacheStats struct {
+	Hits          int
+	Misses        int
+	Invalidations map[string]int `json:",omitempty"` // reason -> count
 }
 
 // Cache represents the entire cache file
 type Cache struct {
 	Entries []CacheEntry
+	Stats   CacheStats
 }
 
+// Reasons a cache entry can be found invalid
 const (
-	cacheFileName = ".grit-cache.json"
-	maxCacheSize  = 100 // Maximum number of cache entries to keep
+	reasonExpired     = "expired"
+	reasonPathMissing = "path missing"
+	reasonRefMissing  = "ref missing"
+	reasonRefMoved    = "ref moved"
+	reasonWindow      = "time window changed"
 )
 
-var getCachePathFn = defaultGetCachePath
+// cacheTTL is how long a cache entry is trusted
+const cacheTTL = 24 * time.Hour
+
+const (
+	cacheDirEnv   = "GRIT_CACHE_DIR"
+	entriesBucket = "entries"
+	metaBucket    = "meta"
+	statsKey      = "stats"
+)
+
+var maxCacheSize = 5000 // Maximum number of cache entries to keep
+
+var (
+	cacheDir      string // --cache-dir
+	getCacheDirFn = defaultGetCacheDir
+)
 
-// defaultGetCachePath returns the default path to the cache file in the user's home directory
-func defaultGetCachePath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+// defaultGetCacheDir returns the cache directory: --cache-dir, then
+// $GRIT_CACHE_DIR, then "grit" in the user's cache directory
+// ($XDG_CACHE_HOME on Linux)
+func defaultGetCacheDir() (string, error) {
+	if cacheDir != "" {
+		return cacheDir, nil
+	}
+	if dir := os.Getenv(cacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	userCacheDir, err := os.UserCacheDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(homeDir, cacheFileName), nil
+	return filepath.Join(userCacheDir, "grit"), nil
+}
+
+// getCacheDir returns the path to the cache directory
+func getCacheDir() (string, error) {
+	return getCacheDirFn()
+}
+
+// openCacheStore opens the key-value store that holds the cache
+func openCacheStore() (kvStore, error) {
+	dir, err := getCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	store, err := newDirStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateCacheStore(store); err != nil {
+		return nil, err
+	}
+	return store, nil
 }
 
-// getCachePath returns the path to the cache file
-func getCachePath() (string, error) {
-	return getCachePathFn()
+// cacheKey identifies the result for a set of arguments and paths
+func cacheKey(paths []string, args CacheArgs) string {
+	data, _ := json.Marshal(struct {
+		Args  CacheArgs
+		Paths []string
+	}{args, paths})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
-// loadCache loads the cache from the file
+// key returns the key an entry is stored under
+func (e *CacheEntry) key() string {
+	return cacheKey(e.Paths, e.Args)
+}
+
+// loadCache loads every entry and the statistics from the cache, oldest entry first
 func loadCache() (*Cache, error) {
-	cachePath, err := getCachePath()
+	store, err := openCacheStore()
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(cachePath)
+	entries, err := loadCacheEntries(store)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := loadCacheStats(store)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &Cache{Entries: make([]CacheEntry, 0)}, nil
-		}
 		return nil, err
 	}
 
-	var cache Cache
-	if err := json.Unmarshal(data, &cache); err != nil {
+	return &Cache{Entries: entries, Stats: stats}, nil
+}
+
+// loadCacheEntries reads every entry in the store, oldest first
+func loadCacheEntries(store kvStore) ([]CacheEntry, error) {
+	keys, err := store.Keys(entriesBucket)
+	if err != nil {
 		return nil, err
 	}
 
-	return &cache, nil
+	entries := make([]CacheEntry, 0, len(keys))
+	for _, key := range keys {
+		entry, err := getCacheEntry(store, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries, nil
+}
+
+// getCacheEntry reads a single entry, migrated to the current version, or
+// returns nil if there is none or it was written by a newer grit
+func getCacheEntry(store kvStore, key string) (*CacheEntry, error) {
+	data, err := store.Get(entriesBucket, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		// A corrupted entry is only a lost optimisation; drop it and let
+		// the next run replace it
+		return nil, nil
+	}
+	if entry.Version == 0 {
+		// Entries were first stored one per file without a version
+		entry.Version = 1
+	}
+	if !upgradeCacheEntry(&entry) {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// isNewerCacheEntry reports whether the entry stored under key was written
+// by a newer grit, and so must be left alone
+func isNewerCacheEntry(store kvStore, key string) bool {
+	data, err := store.Get(entriesBucket, key)
+	if err != nil || data == nil {
+		return false
+	}
+	var entry struct{ Version int }
+	return json.Unmarshal(data, &entry) == nil && entry.Version > cacheSchemaVersion
+}
+
+// loadCacheStats reads the hit/miss statistics
+func loadCacheStats(store kvStore) (CacheStats, error) {
+	var stats CacheStats
+	data, err := store.Get(metaBucket, statsKey)
+	if err != nil || data == nil {
+		return stats, err
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		// Start counting afresh rather than failing on corrupted statistics
+		return CacheStats{}, nil
+	}
+	return stats, nil
 }
 
-// saveCache saves the cache to the file
+// saveCache replaces the contents of the cache with the given entries and
+// statistics, keeping only the newest maxCacheSize entries. Entries written
+// by a newer grit are kept. Callers that read, modify and write the cache
+// should use updateCache.
 func saveCache(cache *Cache) error {
+	store, err := openCacheStore()
+	if err != nil {
+		return err
+	}
+
 	// Limit cache size
+	sort.SliceStable(cache.Entries, func(i, j int) bool {
+		return cache.Entries[i].Timestamp.Before(cache.Entries[j].Timestamp)
+	})
 	if len(cache.Entries) > maxCacheSize {
 		cache.Entries = cache.Entries[len(cache.Entries)-maxCacheSize:]
 	}
 
-	data, err := json.MarshalIndent(cache, "", "  ")
+	keep := make(map[string]bool, len(cache.Entries))
+	for i := range cache.Entries {
+		keep[cache.Entries[i].key()] = true
+		if err := putCacheEntry(store, cache.Entries[i]); err != nil {
+			return err
+		}
+	}
+
+	keys, err := store.Keys(entriesBucket)
 	if err != nil {
 		return err
 	}
+	for _, key := range keys {
+		if !keep[key] && !isNewerCacheEntry(store, key) {
+			if err := store.Delete(entriesBucket, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return putCacheStats(store, cache.Stats)
+}
 
-	cachePath, err := getCachePath()
+// putCacheEntry writes a single entry, replacing any entry for the same arguments
+func putCacheEntry(store kvStore, entry CacheEntry) error {
+	entry.Version = cacheSchemaVersion
+	data, err := json.MarshalIndent(entry, "", "  ")
 	if err != nil {
 		return err
 	}
+	return store.Put(entriesBucket, entry.key(), data)
+}
 
-	return os.WriteFile(cachePath, data, 0644)
+// putCacheStats writes the hit/miss statistics
+func putCacheStats(store kvStore, stats CacheStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(metaBucket, statsKey, data)
 }
 
-// findMatchingCacheEntry finds a cache entry that matches the given arguments
-func findMatchingCacheEntry(cache *Cache, args []string, authorRegex, remoteName, filenamesRegex string, weekToDate bool) *CacheEntry {
-	for i := len(cache.Entries) - 1; i >= 0; i-- {
-		entry := &cache.Entries[i]
-		if entry.Args.AuthorRegex != authorRegex ||
-			entry.Args.RemoteName != remoteName ||
-			entry.Args.FilenamesRegex != filenamesRegex ||
-			entry.Args.WeekToDate != weekToDate ||
-			len(entry.Paths) != len(args) {
-			continue
-		}
+// findMatchingCacheEntry looks up the cache entry for the given arguments
+func findMatchingCacheEntry(args []string, cacheArgs CacheArgs) (*CacheEntry, error) {
+	store, err := openCacheStore()
+	if err != nil {
+		return nil, err
+	}
+	return getCacheEntry(store, cacheKey(args, cacheArgs))
+}
 
-		// Check if paths match
-		pathsMatch := true
-		for j, path := range args {
-			if entry.Paths[j] != path {
-				pathsMatch = false
-				break
-			}
+// storeCacheEntry saves a new result and records the lookup that preceded it
+// as a miss. The oldest entries are evicted once the cache is full. Callers
+// must hold the cache lock.
+func storeCacheEntry(entry CacheEntry) error {
+	store, err := openCacheStore()
+	if err != nil {
+		return err
+	}
+
+	if err := putCacheEntry(store, entry); err != nil {
+		return err
+	}
+
+	keys, err := store.Keys(entriesBucket)
+	if err != nil {
+		return err
+	}
+	if len(keys) > maxCacheSize {
+		entries, err := loadCacheEntries(store)
+		if err != nil {
+			return err
 		}
-		if !pathsMatch {
-			continue
+		for i := 0; i < len(entries)-maxCacheSize; i++ {
+			if err := store.Delete(entriesBucket, entries[i].key()); err != nil {
+				return err
+			}
 		}
+	}
 
-		return entry
+	return updateCacheStats(store, func(stats *CacheStats) {
+		stats.recordMiss(entry.Rejected)
+	})
+}
+
+// updateCacheStats applies a change to the statistics. Callers must hold the
+// cache lock.
+func updateCacheStats(store kvStore, update func(stats *CacheStats)) error {
+	stats, err := loadCacheStats(store)
+	if err != nil {
+		return err
 	}
-	return nil
+	update(&stats)
+	return putCacheStats(store, stats)
+}
+
+// recordCacheHit counts a cached result being used
+func recordCacheHit() error {
+	return withCacheLock(func() error {
+		store, err := openCacheStore()
+		if err != nil {
+			return err
+		}
+		return updateCacheStats(store, func(stats *CacheStats) {
+			stats.Hits++
+		})
+	})
 }
 
 // isCacheValid checks if a cache entry is still valid
 func isCacheValid(entry *CacheEntry, paths []string) bool {
-	// Check if cache is too old (24 hours)
-	if time.Since(entry.Timestamp) > 24*time.Hour {
-		return false
+	return cacheInvalidReason(entry, paths) == ""
+}
+
+// cacheInvalidReason returns why a cache entry can no longer be used, or an
+// empty string if it is still valid
+func cacheInvalidReason(entry *CacheEntry, paths []string) string {
+	// Check if cache is too old
+	now := timeNow()
+	if now.Sub(entry.Timestamp) > cacheTTL {
+		return reasonExpired
 	}
 
-	// Check if all paths still exist and have matching HEAD hashes
-	for _, path := range paths {
-		repo, err := git.PlainOpen(path)
+	// Check that the result was counted over the current day or week. A
+	// result from before midnight must not be served as today's number.
+	// A followed file is counted over its whole history, whatever the time.
+	if entry.Args.Follow == "" && (now.Before(entry.WindowStart) || !now.Before(entry.WindowEnd)) {
+		return reasonWindow
+	}
+
+	// Check that every path still exists and that each spec still resolves to
+	// the commit the result was computed from
+	for _, pathSpec := range paths {
+		spec := parseRevisionSpec(pathSpec)
+		repo, err := git.PlainOpen(spec.Path)
 		if err != nil {
-			return false
+			return reasonPathMissing
 		}
 
-		head, err := repo.Head()
+		ref, err := spec.resolve(repo, entry.Args.RemoteName)
 		if err != nil {
-			return false
+			return reasonRefMissing
 		}
 
-		cachedHash, exists := entry.HeadHashes[path]
-		if !exists || cachedHash != head.Hash().String() {
-			return false
+		cachedHash, exists := entry.HeadHashes[pathSpec]
+		if !exists || cachedHash != ref.Hash().String() {
+			return reasonRefMoved
 		}
 	}
 
-	return true
+	return ""
+}
+
+// recordMiss counts a result that had to be computed. If an entry was found
+// but rejected, the reason is tallied.
+func (s *CacheStats) recordMiss(reason string) {
+	s.Misses++
+	if reason == "" {
+		return
+	}
+	if s.Invalidations == nil {
+		s.Invalidations = make(map[string]int)
+	}
+	s.Invalidations[reason]++
 }
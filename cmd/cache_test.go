@@ -1,24 +1,37 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-// testCachePath is used to override the cache path during testing
-var testCachePath string
+// testCacheDir is used to override the cache directory during testing
+var testCacheDir string
 
-// getCachePathForTest returns the test cache path if set, otherwise delegates to getCachePath
-func getCachePathForTest() (string, error) {
-	if testCachePath != "" {
-		return testCachePath, nil
+// getCacheDirForTest returns the test cache directory if set, otherwise delegates to getCacheDir
+func getCacheDirForTest() (string, error) {
+	if testCacheDir != "" {
+		return testCacheDir, nil
 	}
-	return getCachePath()
+	return getCacheDir()
+}
+
+func TestMain(m *testing.M) {
+	// Never migrate a real ~/.grit-cache.json into a test cache
+	legacyCachePathFn = func() (string, error) {
+		return "", os.ErrNotExist
+	}
+	os.Exit(m.Run())
 }
 
 func TestCacheOperations(t *testing.T) {
@@ -30,11 +43,11 @@ func TestCacheOperations(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	// Override the cache path for testing
-	originalGetCachePath := getCachePathFn
-	getCachePathFn = func() (string, error) {
-		return filepath.Join(tempDir, cacheFileName), nil
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
 	}
-	defer func() { getCachePathFn = originalGetCachePath }()
+	defer func() { getCacheDirFn = originalGetCacheDir }()
 
 	// Test creating and loading an empty cache
 	cache, err := loadCache()
@@ -47,23 +60,16 @@ func TestCacheOperations(t *testing.T) {
 
 	// Test saving and loading a cache entry
 	entry := CacheEntry{
-		Args: struct {
-			AuthorRegex    string
-			RemoteName     string
-			FilenamesRegex string
-			WeekToDate     bool
-		}{
+		Args: CacheArgs{
 			AuthorRegex:    "test",
 			RemoteName:     "origin",
 			FilenamesRegex: ".*",
 			WeekToDate:     true,
+			DateField:      "author",
 		},
 		Paths:      []string{"./"},
 		HeadHashes: map[string]string{"./": "abc123"},
-		Results: struct {
-			Added   int64
-			Deleted int64
-		}{
+		Results: CacheResults{
 			Added:   100,
 			Deleted: 50,
 		},
@@ -85,17 +91,47 @@ func TestCacheOperations(t *testing.T) {
 	}
 
 	// Test finding matching cache entry
-	foundEntry := findMatchingCacheEntry(cache, []string{"./"}, "test", "origin", ".*", true)
+	foundEntry, err := findMatchingCacheEntry([]string{"./"}, entry.Args)
+	if err != nil {
+		t.Fatalf("Failed to look up cache entry: %v", err)
+	}
 	if foundEntry == nil {
-		t.Error("Failed to find matching cache entry")
+		t.Fatal("Failed to find matching cache entry")
 	}
 	if foundEntry.Results.Added != 100 || foundEntry.Results.Deleted != 50 {
 		t.Errorf("Found entry has incorrect results: +%d/-%d", foundEntry.Results.Added, foundEntry.Results.Deleted)
 	}
 
-	// Test cache size limit
+	// Test that the date field is part of the cache key
+	committerArgs := entry.Args
+	committerArgs.DateField = "committer"
+	if found, _ := findMatchingCacheEntry([]string{"./"}, committerArgs); found != nil {
+		t.Error("Cache entry for author dates matched a committer date query")
+	}
+
+	// Test that saving an entry with the same arguments replaces it
+	entry.Results.Added = 200
+	cache.Entries = append(cache.Entries, entry)
+	if err := saveCache(cache); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+	cache, err = loadCache()
+	if err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	if len(cache.Entries) != 1 || cache.Entries[0].Results.Added != 200 {
+		t.Errorf("Expected the entry to be replaced, got %d entries", len(cache.Entries))
+	}
+
+	// Test cache size limit, keeping the newest entries
+	originalMaxCacheSize := maxCacheSize
+	maxCacheSize = 20
+	defer func() { maxCacheSize = originalMaxCacheSize }()
 	for i := 0; i < maxCacheSize+10; i++ {
-		cache.Entries = append(cache.Entries, entry)
+		e := entry
+		e.Paths = []string{fmt.Sprintf("repo-%d", i)}
+		e.Timestamp = entry.Timestamp.Add(time.Duration(i) * time.Second)
+		cache.Entries = append(cache.Entries, e)
 	}
 	if err := saveCache(cache); err != nil {
 		t.Fatalf("Failed to save cache with size limit: %v", err)
@@ -107,6 +143,9 @@ func TestCacheOperations(t *testing.T) {
 	if len(cache.Entries) != maxCacheSize {
 		t.Errorf("Expected cache size to be limited to %d, got %d", maxCacheSize, len(cache.Entries))
 	}
+	if cache.Entries[len(cache.Entries)-1].Paths[0] != fmt.Sprintf("repo-%d", maxCacheSize+9) {
+		t.Errorf("Expected the newest entry to be kept, got %v", cache.Entries[len(cache.Entries)-1].Paths)
+	}
 }
 
 func TestCacheValidity(t *testing.T) {
@@ -150,10 +189,13 @@ func TestCacheValidity(t *testing.T) {
 		t.Fatalf("Failed to commit: %v", err)
 	}
 
+	windowStart, windowEnd := countWindow(time.Now(), false)
 	entry := CacheEntry{
-		Paths:      []string{tempDir},
-		HeadHashes: map[string]string{tempDir: commit.String()},
-		Timestamp:  time.Now(),
+		Paths:       []string{tempDir},
+		HeadHashes:  map[string]string{tempDir: commit.String()},
+		Timestamp:   time.Now(),
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
 	}
 
 	// Test valid cache
@@ -180,3 +222,667 @@ func TestCacheValidity(t *testing.T) {
 		t.Error("Cache entry with invalid hash was considered valid")
 	}
 }
+
+func TestCacheCorruptionRecovery(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	defer func() { getCacheDirFn = originalGetCacheDir }()
+
+	entry := CacheEntry{Paths: []string{"./"}, Timestamp: time.Now()}
+	for _, path := range []string{
+		filepath.Join(tempDir, entriesBucket, entry.key()),
+		filepath.Join(tempDir, metaBucket, statsKey),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create cache directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(`{"Paths": `), 0644); err != nil {
+			t.Fatalf("Failed to write corrupted cache: %v", err)
+		}
+	}
+
+	cache, err := loadCache()
+	if err != nil {
+		t.Fatalf("Corrupted cache was not recovered: %v", err)
+	}
+	if len(cache.Entries) != 0 {
+		t.Errorf("Expected empty cache after corruption, got %d entries", len(cache.Entries))
+	}
+	if found, err := findMatchingCacheEntry(entry.Paths, entry.Args); err != nil || found != nil {
+		t.Errorf("Expected corrupted entry to be a miss, got %v, %v", found, err)
+	}
+
+	if err := withCacheLock(func() error { return storeCacheEntry(entry) }); err != nil {
+		t.Fatalf("Failed to update corrupted cache: %v", err)
+	}
+	cache, err = loadCache()
+	if err != nil {
+		t.Fatalf("Failed to load repaired cache: %v", err)
+	}
+	if len(cache.Entries) != 1 || cache.Stats.Misses != 1 {
+		t.Errorf("Expected repaired cache to hold 1 entry and 1 miss, got %d and %d", len(cache.Entries), cache.Stats.Misses)
+	}
+}
+
+func TestConcurrentCacheUpdates(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	defer func() { getCacheDirFn = originalGetCacheDir }()
+
+	// Direct updates: every entry written concurrently must survive
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := updateCache(func(c *Cache) {
+				c.Entries = append(c.Entries, CacheEntry{Paths: []string{fmt.Sprintf("repo-%d", i)}})
+			})
+			if err != nil {
+				t.Errorf("Concurrent update failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cache, err := loadCache()
+	if err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	if len(cache.Entries) != writers {
+		t.Errorf("Expected %d entries after concurrent updates, got %d", writers, len(cache.Entries))
+	}
+
+	// Many concurrent runLines calls against the same repository
+	dir, cleanup := setupTestRepoWithDifferentDays(t)
+	defer cleanup()
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = false
+
+	const runs = 20
+	captureStdout(func() {
+		var wg sync.WaitGroup
+		for i := 0; i < runs; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runLines(nil, []string{dir})
+			}()
+		}
+		wg.Wait()
+	})
+
+	onDisk, err := loadCache()
+	if err != nil {
+		t.Fatalf("Failed to load cache after concurrent runs: %v", err)
+	}
+	if got := onDisk.Stats.Hits + onDisk.Stats.Misses; got != runs {
+		t.Errorf("Expected %d recorded lookups, got %d", runs, got)
+	}
+	if len(onDisk.Entries) != writers+1 {
+		t.Errorf("Expected %d entries, got %d", writers+1, len(onDisk.Entries))
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(tempDir, "*", "*"+tempSuffix+"*"))
+	if len(leftovers) != 0 {
+		t.Errorf("Temporary cache files left behind: %v", leftovers)
+	}
+}
+
+func TestCacheWindowValidity(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+
+	// Sunday, January 7, 2024 at 23:50 UTC
+	sundayNight := time.Date(2024, 1, 7, 23, 50, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		computedAt time.Time
+		weekToDate bool
+		now        time.Time
+		wantValid  bool
+	}{
+		{
+			name:       "Today, same day",
+			computedAt: sundayNight.Add(-8 * time.Hour),
+			now:        sundayNight,
+			wantValid:  true,
+		},
+		{
+			name:       "Today, across midnight",
+			computedAt: sundayNight,
+			now:        sundayNight.Add(20 * time.Minute),
+			wantValid:  false,
+		},
+		{
+			name:       "Week to date, Sunday is still the same week",
+			computedAt: time.Date(2024, 1, 6, 23, 50, 0, 0, time.UTC),
+			weekToDate: true,
+			now:        sundayNight,
+			wantValid:  true,
+		},
+		{
+			name:       "Week to date, across midnight on a weekday",
+			computedAt: time.Date(2024, 1, 2, 23, 50, 0, 0, time.UTC),
+			weekToDate: true,
+			now:        time.Date(2024, 1, 3, 0, 10, 0, 0, time.UTC),
+			wantValid:  true,
+		},
+		{
+			name:       "Week to date, across Monday",
+			computedAt: sundayNight,
+			weekToDate: true,
+			now:        sundayNight.Add(20 * time.Minute),
+			wantValid:  false,
+		},
+		{
+			name:       "Clock moved backwards",
+			computedAt: sundayNight,
+			now:        sundayNight.Add(-24 * time.Hour),
+			wantValid:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := countWindow(tt.computedAt, tt.weekToDate)
+			entry := CacheEntry{
+				Timestamp:   tt.computedAt,
+				WindowStart: start,
+				WindowEnd:   end,
+			}
+
+			timeNow = func() time.Time { return tt.now }
+			reason := cacheInvalidReason(&entry, nil)
+			if tt.wantValid && reason != "" {
+				t.Errorf("Expected entry to be valid, got %q", reason)
+			}
+			if !tt.wantValid && reason != reasonWindow {
+				t.Errorf("Expected %q, got %q", reasonWindow, reason)
+			}
+		})
+	}
+
+	// Entries written before windows were recorded are never trusted
+	timeNow = func() time.Time { return sundayNight }
+	if reason := cacheInvalidReason(&CacheEntry{Timestamp: sundayNight}, nil); reason != reasonWindow {
+		t.Errorf("Expected entry without a window to be rejected, got %q", reason)
+	}
+}
+
+func TestCacheValidityForBranchesAndRemotes(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	referenceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() {
+		getCacheDirFn = originalGetCacheDir
+		timeNow = time.Now
+		remoteName = ""
+	}()
+
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	mainRef, err := repo.Reference(plumbing.NewBranchReferenceName("main"), true)
+	if err != nil {
+		t.Fatalf("Failed to resolve main: %v", err)
+	}
+	featureRef, err := repo.Reference(plumbing.NewBranchReferenceName("feature"), true)
+	if err != nil {
+		t.Fatalf("Failed to resolve feature: %v", err)
+	}
+	setRef := func(name plumbing.ReferenceName, hash plumbing.Hash) {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			t.Fatalf("Failed to set %s: %v", name, err)
+		}
+	}
+	remoteFeature := plumbing.NewRemoteReferenceName("origin", "feature")
+	setRef(remoteFeature, featureRef.Hash())
+
+	// runAndFind computes a result and returns the cache entry it saved
+	runAndFind := func(remote string, specs ...string) *CacheEntry {
+		authorRegex = ""
+		filenamesRegex = ""
+		weekToDate = false
+		noCache = false
+		remoteName = remote
+		captureStdout(func() { runLines(nil, specs) })
+
+		entry, err := findMatchingCacheEntry(specs, CacheArgs{
+			RemoteName:       remote,
+			DateField:        dateField,
+			CoauthorCredit:   coauthorCredit,
+			CoauthorTrailers: coauthorTrailers,
+			IssueRegex:       issueRegex,
+		})
+		if err != nil {
+			t.Fatalf("Failed to load cache: %v", err)
+		}
+		if entry == nil {
+			t.Fatalf("No cache entry saved for %v", specs)
+		}
+		return entry
+	}
+
+	featureSpec := dir + "@feature"
+	mainSpec := dir + "@main"
+
+	// A branch spec is keyed and validated by the branch, not HEAD
+	entry := runAndFind("", featureSpec)
+	if entry.HeadHashes[featureSpec] != featureRef.Hash().String() {
+		t.Errorf("Expected feature hash %s, got %s", featureRef.Hash(), entry.HeadHashes[featureSpec])
+	}
+	if reason := cacheInvalidReason(entry, []string{featureSpec}); reason != "" {
+		t.Errorf("Branch spec entry was rejected: %s", reason)
+	}
+
+	// Two branches of the same repository are tracked separately
+	both := runAndFind("", mainSpec, featureSpec)
+	if both.HeadHashes[mainSpec] != mainRef.Hash().String() || both.HeadHashes[featureSpec] != featureRef.Hash().String() {
+		t.Errorf("Branch hashes were mixed up: %v", both.HeadHashes)
+	}
+
+	// A remote spec follows the remote branch, not the local one
+	remoteEntry := runAndFind("origin", featureSpec)
+	if reason := cacheInvalidReason(remoteEntry, []string{featureSpec}); reason != "" {
+		t.Errorf("Remote spec entry was rejected: %s", reason)
+	}
+
+	// Moving HEAD's branch does not affect the feature branch entry
+	setRef(plumbing.NewBranchReferenceName("main"), featureRef.Hash())
+	if reason := cacheInvalidReason(entry, []string{featureSpec}); reason != "" {
+		t.Errorf("Branch spec entry was rejected after HEAD moved: %s", reason)
+	}
+	if reason := cacheInvalidReason(both, []string{mainSpec, featureSpec}); reason != reasonRefMoved {
+		t.Errorf("Expected %q after main moved, got %q", reasonRefMoved, reason)
+	}
+	setRef(plumbing.NewBranchReferenceName("main"), mainRef.Hash())
+
+	// Moving the local branch invalidates the local entry but not the remote one
+	setRef(plumbing.NewBranchReferenceName("feature"), mainRef.Hash())
+	if reason := cacheInvalidReason(entry, []string{featureSpec}); reason != reasonRefMoved {
+		t.Errorf("Expected %q after feature moved, got %q", reasonRefMoved, reason)
+	}
+	if reason := cacheInvalidReason(remoteEntry, []string{featureSpec}); reason != "" {
+		t.Errorf("Remote spec entry was rejected after the local branch moved: %s", reason)
+	}
+
+	// Moving the remote branch invalidates the remote entry
+	setRef(remoteFeature, mainRef.Hash())
+	if reason := cacheInvalidReason(remoteEntry, []string{featureSpec}); reason != reasonRefMoved {
+		t.Errorf("Expected %q after origin/feature moved, got %q", reasonRefMoved, reason)
+	}
+
+	// A deleted branch is reported as such
+	if err := repo.Storer.RemoveReference(remoteFeature); err != nil {
+		t.Fatalf("Failed to remove %s: %v", remoteFeature, err)
+	}
+	if reason := cacheInvalidReason(remoteEntry, []string{featureSpec}); reason != reasonRefMissing {
+		t.Errorf("Expected %q after origin/feature was deleted, got %q", reasonRefMissing, reason)
+	}
+}
+
+func TestDefaultGetCacheDir(t *testing.T) {
+	defer func() { cacheDir = "" }()
+
+	xdg := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", xdg)
+	t.Setenv(cacheDirEnv, "")
+
+	if runtime.GOOS == "linux" {
+		dir, err := defaultGetCacheDir()
+		if err != nil {
+			t.Fatalf("Failed to get cache dir: %v", err)
+		}
+		if dir != filepath.Join(xdg, "grit") {
+			t.Errorf("Expected XDG cache dir, got %s", dir)
+		}
+	}
+
+	t.Setenv(cacheDirEnv, "/from/env")
+	if dir, _ := defaultGetCacheDir(); dir != "/from/env" {
+		t.Errorf("Expected %s to take precedence, got %s", cacheDirEnv, dir)
+	}
+
+	cacheDir = "/from/flag"
+	if dir, _ := defaultGetCacheDir(); dir != "/from/flag" {
+		t.Errorf("Expected --cache-dir to take precedence, got %s", dir)
+	}
+}
+
+// legacyCacheFixture is ~/.grit-cache.json as written before version 1
+const legacyCacheFixture = `{
+  "Entries": [
+    {
+      "Args": {
+        "AuthorRegex": "Nathanael",
+        "RemoteName": "",
+        "FilenamesRegex": "",
+        "WeekToDate": true
+      },
+      "Paths": [
+        "/src/grit"
+      ],
+      "HeadHashes": {
+        "/src/grit": "8f14e45fceea167a5a36dedd4bea2543e1a4b7c3"
+      },
+      "Results": {
+        "Added": 141,
+        "Deleted": 38
+      },
+      "Timestamp": "2024-01-03T09:30:00Z"
+    },
+    {
+      "Args": {
+        "AuthorRegex": "",
+        "RemoteName": "origin",
+        "FilenamesRegex": "\\.go$",
+        "WeekToDate": false
+      },
+      "Paths": [
+        "/src/grit@main"
+      ],
+      "HeadHashes": {
+        "/src/grit": "8f14e45fceea167a5a36dedd4bea2543e1a4b7c3"
+      },
+      "Results": {
+        "Added": 12,
+        "Deleted": 0
+      },
+      "Timestamp": "2024-01-03T23:50:00Z"
+    }
+  ]
+}`
+
+// unversionedEntryFixture is a cache entry as written by version 1
+const unversionedEntryFixture = `{
+  "Args": {
+    "AuthorRegex": "",
+    "Authors": null,
+    "CommitterRegex": "",
+    "ExcludeAuthors": null,
+    "ExcludeBots": true,
+    "RemoteName": "",
+    "FilenamesRegex": "",
+    "WeekToDate": false,
+    "DateField": "committer",
+    "CoauthorCredit": "split",
+    "CoauthorTrailers": [
+      "Co-authored-by"
+    ],
+    "GroupBy": "type",
+    "Grep": null,
+    "InvertGrep": false,
+    "IssueRegex": "\\b[A-Z][A-Z0-9]+-[0-9]+\\b"
+  },
+  "Paths": [
+    "/src/grit"
+  ],
+  "HeadHashes": {
+    "/src/grit": "8f14e45fceea167a5a36dedd4bea2543e1a4b7c3"
+  },
+  "Results": {
+    "Added": 20,
+    "Deleted": 5,
+    "Groups": [
+      {
+        "Key": "feat",
+        "Added": 20,
+        "Deleted": 5,
+        "Commits": 2
+      }
+    ]
+  },
+  "Timestamp": "2024-01-03T09:30:00Z",
+  "WindowStart": "2024-01-03T00:00:00Z",
+  "WindowEnd": "2024-01-04T00:00:00Z"
+}`
+
+// futureEntryFixture is a cache entry from a newer grit, with fields this
+// version doesn't know about
+const futureEntryFixture = `{
+  "Version": 99,
+  "Args": {
+    "AuthorRegex": "",
+    "DateField": "author",
+    "Since": "2 weeks ago"
+  },
+  "Paths": [
+    "/src/grit"
+  ],
+  "Results": {
+    "Added": 1,
+    "Deleted": 1
+  },
+  "Timestamp": "2024-01-03T09:30:00Z"
+}`
+
+func TestCacheMigrationFromHomeFile(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	originalLegacyCachePath := legacyCachePathFn
+	getCacheDirFn = func() (string, error) {
+		return filepath.Join(tempDir, "cache"), nil
+	}
+	legacyPath := filepath.Join(tempDir, legacyCacheFileName)
+	legacyCachePathFn = func() (string, error) {
+		return legacyPath, nil
+	}
+	defer func() {
+		getCacheDirFn = originalGetCacheDir
+		legacyCachePathFn = originalLegacyCachePath
+	}()
+
+	if err := os.WriteFile(legacyPath, []byte(legacyCacheFixture), 0644); err != nil {
+		t.Fatalf("Failed to write legacy cache: %v", err)
+	}
+
+	cache, err := loadCache()
+	if err != nil {
+		t.Fatalf("Failed to load migrated cache: %v", err)
+	}
+	if len(cache.Entries) != 2 {
+		t.Fatalf("Expected 2 migrated entries, got %d", len(cache.Entries))
+	}
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy cache file to be removed, got %v", err)
+	}
+	// Another grit migrating it at the same time may have removed it first
+	if err := removeHomeFile(legacyPath); err != nil {
+		t.Errorf("Expected removing an already removed legacy cache to succeed, got %v", err)
+	}
+
+	// Entries are found with the defaults of flags added since
+	args := CacheArgs{
+		AuthorRegex:      "Nathanael",
+		WeekToDate:       true,
+		DateField:        "author",
+		CoauthorCredit:   "full",
+		CoauthorTrailers: []string{"Co-authored-by"},
+		IssueRegex:       defaultIssueRegex,
+	}
+	entry, err := findMatchingCacheEntry([]string{"/src/grit"}, args)
+	if err != nil || entry == nil {
+		t.Fatalf("Expected the migrated entry to be found, got %v, %v", entry, err)
+	}
+	if entry.Version != cacheSchemaVersion {
+		t.Errorf("Expected version %d, got %d", cacheSchemaVersion, entry.Version)
+	}
+	if entry.Results.Added != 141 || entry.Results.Deleted != 38 {
+		t.Errorf("Expected +141/-38, got +%d/-%d", entry.Results.Added, entry.Results.Deleted)
+	}
+
+	// The window is reconstructed from the timestamp: the week starting on
+	// Monday 1 January 2024
+	weekStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !entry.WindowStart.Equal(weekStart) || !entry.WindowEnd.Equal(weekStart.AddDate(0, 0, 7)) {
+		t.Errorf("Expected the week of %s, got %s to %s", weekStart, entry.WindowStart, entry.WindowEnd)
+	}
+
+	// Branch specs were recorded against the bare path, so they are recounted
+	args = CacheArgs{
+		RemoteName:       "origin",
+		FilenamesRegex:   `\.go$`,
+		DateField:        "author",
+		CoauthorCredit:   "full",
+		CoauthorTrailers: []string{"Co-authored-by"},
+		IssueRegex:       defaultIssueRegex,
+	}
+	entry, err = findMatchingCacheEntry([]string{"/src/grit@main"}, args)
+	if err != nil || entry == nil {
+		t.Fatalf("Expected the migrated branch entry to be found, got %v, %v", entry, err)
+	}
+	timeNow = func() time.Time { return time.Date(2024, 1, 3, 23, 55, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+	if reason := cacheInvalidReason(entry, entry.Paths); reason == "" {
+		t.Error("Expected the migrated branch entry to be invalid")
+	}
+
+	// The store is only migrated once
+	if err := os.WriteFile(legacyPath, []byte(legacyCacheFixture), 0644); err != nil {
+		t.Fatalf("Failed to write legacy cache: %v", err)
+	}
+	if _, err := loadCache(); err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	if _, err := os.Stat(legacyPath); err != nil {
+		t.Errorf("Expected a legacy file written after migration to be left alone, got %v", err)
+	}
+}
+
+func TestCacheMigrationFromUnversionedEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	defer func() { getCacheDirFn = originalGetCacheDir }()
+
+	args := CacheArgs{
+		ExcludeBots:      true,
+		DateField:        "committer",
+		CoauthorCredit:   "split",
+		CoauthorTrailers: []string{"Co-authored-by"},
+		GroupBy:          "type",
+		IssueRegex:       defaultIssueRegex,
+	}
+	paths := []string{"/src/grit"}
+	path := filepath.Join(tempDir, entriesBucket, cacheKey(paths, args))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(unversionedEntryFixture), 0644); err != nil {
+		t.Fatalf("Failed to write cache entry: %v", err)
+	}
+
+	entry, err := findMatchingCacheEntry(paths, args)
+	if err != nil || entry == nil {
+		t.Fatalf("Expected the unversioned entry to be found, got %v, %v", entry, err)
+	}
+	if entry.Version != cacheSchemaVersion {
+		t.Errorf("Expected version %d, got %d", cacheSchemaVersion, entry.Version)
+	}
+	if len(entry.Results.Groups) != 1 || entry.Results.Groups[0].Key != "feat" {
+		t.Errorf("Expected the feat group to survive migration, got %v", entry.Results.Groups)
+	}
+
+	// Entries are written with the current version
+	if err := withCacheLock(func() error { return storeCacheEntry(*entry) }); err != nil {
+		t.Fatalf("Failed to store cache entry: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read cache entry: %v", err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"Version": %d`, cacheSchemaVersion)) {
+		t.Errorf("Expected the stored entry to record its version, got %s", data)
+	}
+}
+
+func TestCacheIgnoresNewerVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	defer func() { getCacheDirFn = originalGetCacheDir }()
+
+	args := CacheArgs{DateField: "author"}
+	paths := []string{"/src/grit"}
+	path := filepath.Join(tempDir, entriesBucket, cacheKey(paths, args))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(futureEntryFixture), 0644); err != nil {
+		t.Fatalf("Failed to write cache entry: %v", err)
+	}
+
+	if entry, err := findMatchingCacheEntry(paths, args); err != nil || entry != nil {
+		t.Errorf("Expected an entry from a newer grit to be a miss, got %v, %v", entry, err)
+	}
+
+	cache, err := loadCache()
+	if err != nil {
+		t.Fatalf("Failed to load cache: %v", err)
+	}
+	if len(cache.Entries) != 0 {
+		t.Errorf("Expected entries from a newer grit to be skipped, got %d", len(cache.Entries))
+	}
+
+	// Rewriting the cache leaves them in place for the grit that wrote them
+	if err := saveCache(cache); err != nil {
+		t.Fatalf("Failed to save cache: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != futureEntryFixture {
+		t.Errorf("Expected the newer entry to be left alone, got %s, %v", data, err)
+	}
+}
+
+func TestCacheMigrationsCoverEveryVersion(t *testing.T) {
+	if len(cacheMigrations) != cacheSchemaVersion {
+		t.Errorf("Expected %d migrations, one per version, got %d", cacheSchemaVersion, len(cacheMigrations))
+	}
+}
+
+func TestUpgradeExpiresChangedBreakdowns(t *testing.T) {
+	now := time.Now()
+	byType := CacheEntry{Version: 5, Args: CacheArgs{GroupBy: "type"}, Timestamp: now}
+	byIssue := CacheEntry{Version: 6, Args: CacheArgs{GroupBy: "issue"}, Timestamp: now}
+	byIssueShared := CacheEntry{Version: 7, Args: CacheArgs{GroupBy: "issue"}, Timestamp: now}
+	byAuthor := CacheEntry{Version: 5, Args: CacheArgs{GroupBy: "author"}, Timestamp: now}
+	upgradeCacheEntry(&byType)
+	upgradeCacheEntry(&byIssue)
+	upgradeCacheEntry(&byIssueShared)
+	upgradeCacheEntry(&byAuthor)
+
+	if reason := cacheInvalidReason(&byType, nil); reason != reasonExpired {
+		t.Errorf("Expected a breakdown by type without breaking counts to be expired, got %q", reason)
+	}
+	if reason := cacheInvalidReason(&byIssue, nil); reason != reasonExpired {
+		t.Errorf("Expected a breakdown by issue crediting main line commits to the branch to be expired, got %q", reason)
+	}
+	if reason := cacheInvalidReason(&byIssueShared, nil); reason != reasonExpired {
+		t.Errorf("Expected a breakdown by issue counting shared commits in full to be expired, got %q", reason)
+	}
+	if !byAuthor.Timestamp.Equal(now) {
+		t.Errorf("Expected other breakdowns to keep their timestamp, got %v", byAuthor.Timestamp)
+	}
+}
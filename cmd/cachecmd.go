@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and manage the results cache",
+	}
+	cacheListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List cache entries with their arguments, age and validity",
+		Args:  cobra.NoArgs,
+		Run:   runCacheList,
+	}
+	cacheShowCmd = &cobra.Command{
+		Use:   "show <index>",
+		Short: "Show a single cache entry in full",
+		Args:  cobra.ExactArgs(1),
+		Run:   runCacheShow,
+	}
+	cacheClearCmd = &cobra.Command{
+		Use:   "clear [repositories...]",
+		Short: "Remove cache entries for the given repositories, or everything",
+		Run:   runCacheClear,
+	}
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cache entries that are expired or no longer valid",
+		Long: `Remove cache entries that are expired or no longer valid, and the cached
+line changes of commits and blames of files that haven't been used for 30
+days.`,
+		Args: cobra.NoArgs,
+		Run:  runCachePrune,
+	}
+	cacheStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show cache hit/miss statistics",
+		Args:  cobra.NoArgs,
+		Run:   runCacheStats,
+	}
+)
+
+// cacheUnusedTTL is how long cached commit stats and blames are kept without
+// being used before grit cache prune removes them
+const cacheUnusedTTL = 30 * 24 * time.Hour
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd, cacheShowCmd, cacheClearCmd, cachePruneCmd, cacheStatsCmd)
+}
+
+func runCacheList(cmd *cobra.Command, args []string) {
+	cache, err := loadCache()
+	if err != nil {
+		fmt.Printf("Error loading cache: %v\n", err)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "INDEX\tAGE\tPATHS\tARGS\tRESULT\tSTATUS\n")
+	for i := range cache.Entries {
+		entry := &cache.Entries[i]
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t+%d/-%d\t%s\n",
+			i,
+			formatAge(time.Since(entry.Timestamp)),
+			strings.Join(entry.Paths, " "),
+			describeCacheArgs(entry.Args),
+			entry.Results.Added, entry.Results.Deleted,
+			entryStatus(entry))
+	}
+	w.Flush()
+}
+
+func runCacheShow(cmd *cobra.Command, args []string) {
+	cache, err := loadCache()
+	if err != nil {
+		fmt.Printf("Error loading cache: %v\n", err)
+		return
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil || index < 0 || index >= len(cache.Entries) {
+		fmt.Printf("Error: no cache entry with index %s\n", args[0])
+		return
+	}
+
+	entry := &cache.Entries[index]
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		fmt.Printf("Error formatting cache entry: %v\n", err)
+		return
+	}
+	fmt.Printf("%s\n", data)
+	fmt.Printf("Age:    %s\n", formatAge(time.Since(entry.Timestamp)))
+	fmt.Printf("Status: %s\n", entryStatus(entry))
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) {
+	var removed int
+	err := updateCache(func(cache *Cache) {
+		kept := make([]CacheEntry, 0, len(cache.Entries))
+		for _, entry := range cache.Entries {
+			if len(args) > 0 && !entryUsesRepository(&entry, args) {
+				kept = append(kept, entry)
+			}
+		}
+		removed = len(cache.Entries) - len(kept)
+		cache.Entries = kept
+	})
+	if err == nil && len(args) == 0 {
+		err = clearCommitStats()
+	}
+	if err == nil && len(args) == 0 {
+		err = clearBlames()
+	}
+	if err != nil {
+		fmt.Printf("Error updating cache: %v\n", err)
+		return
+	}
+	fmt.Printf("Removed %d cache entries\n", removed)
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) {
+	var removed int
+	pruned := make(map[string]int)
+	err := updateCache(func(cache *Cache) {
+		kept := make([]CacheEntry, 0, len(cache.Entries))
+		for _, entry := range cache.Entries {
+			if reason := cacheInvalidReason(&entry, entry.Paths); reason != "" {
+				pruned[reason]++
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		removed = len(cache.Entries) - len(kept)
+		cache.Entries = kept
+	})
+	if err != nil {
+		fmt.Printf("Error updating cache: %v\n", err)
+		return
+	}
+	fmt.Printf("Pruned %d cache entries\n", removed)
+	for _, reason := range sortedKeys(pruned) {
+		fmt.Printf("    %s: %d\n", reason, pruned[reason])
+	}
+
+	store, err := openCacheStore()
+	if err != nil {
+		fmt.Printf("Error opening cache: %v\n", err)
+		return
+	}
+	before := time.Now().Add(-cacheUnusedTTL)
+	stats, err := pruneBucket(store, commitsBucket, before)
+	if err != nil {
+		fmt.Printf("Error pruning commit stats: %v\n", err)
+		return
+	}
+	blames, err := pruneBucket(store, blameBucket, before)
+	if err != nil {
+		fmt.Printf("Error pruning blames: %v\n", err)
+		return
+	}
+	// The last changes blames are keyed by go with them, uncounted
+	if _, err := pruneBucket(store, lastChangesBucket, before); err != nil {
+		fmt.Printf("Error pruning blames: %v\n", err)
+		return
+	}
+	fmt.Printf("Pruned %d commit stats and %d blames unused for %d days\n", stats, blames, int(cacheUnusedTTL.Hours()/24))
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) {
+	cache, err := loadCache()
+	if err != nil {
+		fmt.Printf("Error loading cache: %v\n", err)
+		return
+	}
+
+	dir, err := getCacheDir()
+	if err != nil {
+		fmt.Printf("Error locating cache: %v\n", err)
+		return
+	}
+
+	var size int64
+	filepath.WalkDir(filepath.Join(dir, entriesBucket), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+
+	lookups := cache.Stats.Hits + cache.Stats.Misses
+	var hitRate float64
+	if lookups > 0 {
+		hitRate = 100 * float64(cache.Stats.Hits) / float64(lookups)
+	}
+
+	fmt.Printf("Cache dir:  %s\n", dir)
+	fmt.Printf("Entries:    %d (max %d, %d bytes)\n", len(cache.Entries), maxCacheSize, size)
+	fmt.Printf("Hits:       %d\n", cache.Stats.Hits)
+	fmt.Printf("Misses:     %d\n", cache.Stats.Misses)
+	fmt.Printf("Hit rate:   %.1f%%\n", hitRate)
+	if len(cache.Stats.Invalidations) > 0 {
+		fmt.Printf("Invalidations:\n")
+		for _, reason := range sortedKeys(cache.Stats.Invalidations) {
+			fmt.Printf("    %s: %d\n", reason, cache.Stats.Invalidations[reason])
+		}
+	}
+}
+
+// entryStatus describes whether an entry would be used, and if not, why
+func entryStatus(entry *CacheEntry) string {
+	if reason := cacheInvalidReason(entry, entry.Paths); reason != "" {
+		return "invalid (" + reason + ")"
+	}
+	return "valid"
+}
+
+// entryUsesRepository reports whether any of an entry's path specs refer to one of the repositories
+func entryUsesRepository(entry *CacheEntry, repositories []string) bool {
+	for _, pathSpec := range entry.Paths {
+		path := pathSpec
+		if idx := strings.LastIndex(pathSpec, "@"); idx != -1 {
+			path = pathSpec[:idx]
+		}
+		for _, repository := range repositories {
+			if filepath.Clean(path) == filepath.Clean(repository) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeCacheArgs formats the non-default arguments of an entry as flags
+func describeCacheArgs(a CacheArgs) string {
+	var flags []string
+	addString := func(name, value string) {
+		if value != "" {
+			flags = append(flags, fmt.Sprintf("--%s=%s", name, value))
+		}
+	}
+	addStrings := func(name string, values []string) {
+		for _, value := range values {
+			addString(name, value)
+		}
+	}
+	addBool := func(name string, value bool) {
+		if value {
+			flags = append(flags, "--"+name)
+		}
+	}
+
+	addString("author-regex", a.AuthorRegex)
+	addStrings("author", a.Authors)
+	addString("committer-regex", a.CommitterRegex)
+	addStrings("exclude-author", a.ExcludeAuthors)
+	addBool("exclude-bots", a.ExcludeBots)
+	addString("remote", a.RemoteName)
+	addString("filenames-regex", a.FilenamesRegex)
+	addBool("week-to-date", a.WeekToDate)
+	if a.DateField != "" && a.DateField != "author" {
+		addString("date-field", a.DateField)
+	}
+	if a.CoauthorCredit != "" && a.CoauthorCredit != "full" {
+		addString("coauthor-credit", a.CoauthorCredit)
+	}
+	if !slices.Equal(a.CoauthorTrailers, []string{defaultCoauthorTrailer}) {
+		addStrings("coauthor-trailer", a.CoauthorTrailers)
+	}
+	addString("by", a.GroupBy)
+	if a.IssueRegex != defaultIssueRegex {
+		addString("issue-regex", a.IssueRegex)
+	}
+	addStrings("grep", a.Grep)
+	addBool("invert-grep", a.InvertGrep)
+	addString("pickaxe", a.Pickaxe)
+	addString("pickaxe-regex", a.PickaxeRegex)
+	addString("follow", a.Follow)
+	if len(a.Pathspecs) > 0 {
+		flags = append(append(flags, "--"), a.Pathspecs...)
+	}
+
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, " ")
+}
+
+// formatAge formats a duration coarsely, e.g. "5m" or "3h"
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureStdout returns everything f prints to stdout
+func captureStdout(f func()) string {
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	f()
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	return buf.String()
+}
+
+// setupCacheCmdTest points the cache at a temporary file and creates a
+// repository with a single commit
+func setupCacheCmdTest(t *testing.T) (string, string) {
+	tempDir := t.TempDir()
+
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	t.Cleanup(func() { getCacheDirFn = originalGetCacheDir })
+
+	repoDir := filepath.Join(tempDir, "repo")
+	repo, err := git.PlainInit(repoDir, false)
+	assert.NoError(t, err)
+	w, err := repo.Worktree()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("one\ntwo\n"), 0644))
+	_, err = w.Add("test.txt")
+	assert.NoError(t, err)
+	commit, err := w.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test Author", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	return repoDir, commit.String()
+}
+
+func TestCacheCommands(t *testing.T) {
+	repoDir, head := setupCacheCmdTest(t)
+	otherDir := filepath.Join(filepath.Dir(repoDir), "gone")
+	dayStart, dayEnd := countWindow(time.Now(), false)
+
+	cache := &Cache{Entries: []CacheEntry{
+		{
+			Args:        CacheArgs{AuthorRegex: "Test", DateField: "author"},
+			Paths:       []string{repoDir},
+			HeadHashes:  map[string]string{repoDir: head},
+			Results:     CacheResults{Added: 2},
+			Timestamp:   time.Now(),
+			WindowStart: dayStart,
+			WindowEnd:   dayEnd,
+		},
+		{
+			Args:        CacheArgs{WeekToDate: true},
+			Paths:       []string{repoDir},
+			HeadHashes:  map[string]string{repoDir: head},
+			Timestamp:   time.Now().Add(-25 * time.Hour),
+			WindowStart: dayStart,
+			WindowEnd:   dayEnd,
+		},
+		{
+			Paths:       []string{repoDir},
+			HeadHashes:  map[string]string{repoDir: "0000000000000000000000000000000000000000"},
+			Timestamp:   time.Now(),
+			WindowStart: dayStart,
+			WindowEnd:   dayEnd,
+		},
+		{
+			Paths:       []string{otherDir},
+			HeadHashes:  map[string]string{otherDir: head},
+			Timestamp:   time.Now(),
+			WindowStart: dayStart,
+			WindowEnd:   dayEnd,
+		},
+	}}
+	assert.NoError(t, saveCache(cache))
+
+	output := captureStdout(func() { runCacheList(nil, nil) })
+	assert.Contains(t, output, "--author-regex=Test")
+	assert.Contains(t, output, "--week-to-date")
+	assert.Contains(t, output, "valid")
+	assert.Contains(t, output, "invalid (expired)")
+	assert.Contains(t, output, "invalid (ref moved)")
+	assert.Contains(t, output, "invalid (path missing)")
+
+	// Entries are listed oldest first, so the expired entry comes first
+	output = captureStdout(func() { runCacheShow(nil, []string{"1"}) })
+	assert.Contains(t, output, `"AuthorRegex": "Test"`)
+	assert.Contains(t, output, "Status: valid")
+
+	output = captureStdout(func() { runCacheShow(nil, []string{"9"}) })
+	assert.Contains(t, output, "Error: no cache entry with index 9")
+
+	// Commit stats and blames are pruned once unused for long enough
+	store, err := openCacheStore()
+	assert.NoError(t, err)
+	old := time.Now().Add(-cacheUnusedTTL - time.Hour)
+	for _, bucket := range []string{commitsBucket, blameBucket} {
+		for _, key := range []string{"used", "unused"} {
+			assert.NoError(t, store.Put(bucket, key, []byte("{}")))
+			assert.NoError(t, os.Chtimes(filepath.Join(filepath.Dir(repoDir), bucket, key), old, old))
+		}
+		_, err := store.Get(bucket, "used")
+		assert.NoError(t, err)
+	}
+
+	output = captureStdout(func() { runCachePrune(nil, nil) })
+	assert.Contains(t, output, "Pruned 3 cache entries")
+	assert.Contains(t, output, "expired: 1")
+	assert.Contains(t, output, "ref moved: 1")
+	assert.Contains(t, output, "path missing: 1")
+	assert.Contains(t, output, "Pruned 1 commit stats and 1 blames unused for 30 days")
+	for _, bucket := range []string{commitsBucket, blameBucket} {
+		keys, err := store.Keys(bucket)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"used"}, keys, bucket)
+	}
+
+	cache, err = loadCache()
+	assert.NoError(t, err)
+	assert.Len(t, cache.Entries, 1)
+
+	output = captureStdout(func() { runCacheClear(nil, []string{otherDir}) })
+	assert.Contains(t, output, "Removed 0 cache entries")
+
+	output = captureStdout(func() { runCacheClear(nil, []string{repoDir + "/"}) })
+	assert.Contains(t, output, "Removed 1 cache entries")
+
+	cache, err = loadCache()
+	assert.NoError(t, err)
+	assert.Empty(t, cache.Entries)
+}
+
+func TestCacheStatsRecorded(t *testing.T) {
+	repoDir, _ := setupCacheCmdTest(t)
+	defer func() {
+		authorRegex = ""
+		noCache = false
+	}()
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = false
+
+	// A miss, then a hit
+	captureStdout(func() { runLines(nil, []string{repoDir}) })
+	captureStdout(func() { runLines(nil, []string{repoDir}) })
+
+	// Move HEAD so the cached entry is rejected
+	repo, err := git.PlainOpen(repoDir)
+	assert.NoError(t, err)
+	w, err := repo.Worktree()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("one\n"), 0644))
+	_, err = w.Add("test.txt")
+	assert.NoError(t, err)
+	_, err = w.Commit("Second commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test Author", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+	captureStdout(func() { runLines(nil, []string{repoDir}) })
+
+	cache, err := loadCache()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Stats.Hits)
+	assert.Equal(t, 2, cache.Stats.Misses)
+	assert.Equal(t, map[string]int{reasonRefMoved: 1}, cache.Stats.Invalidations)
+	assert.Equal(t, reasonRefMoved, cache.Entries[0].Rejected)
+
+	output := captureStdout(func() { runCacheStats(nil, nil) })
+	assert.Contains(t, output, "Hits:       1")
+	assert.Contains(t, output, "Misses:     2")
+	assert.Contains(t, output, "Hit rate:   33.3%")
+	assert.Contains(t, output, "ref moved: 1")
+}
+
+func TestCacheExportImport(t *testing.T) {
+	repoDir, head := setupCacheCmdTest(t)
+	defer func() { noCache = false }()
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = false
+
+	// Counting stores the stats of each commit
+	assert.Equal(t, "+2/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	store, err := openCacheStore()
+	assert.NoError(t, err)
+	stats, err := getCommitStats(store, head)
+	assert.NoError(t, err)
+	assert.Equal(t, object.FileStats{{Name: "test.txt", Addition: 2}}, stats)
+
+	exportPath := filepath.Join(t.TempDir(), "export.json")
+	output := captureStdout(func() { runCacheExport(nil, []string{exportPath}) })
+	assert.Equal(t, "Exported 1 commits\n", output)
+
+	// Add a commit the importing repository doesn't have
+	data, err := os.ReadFile(exportPath)
+	assert.NoError(t, err)
+	export, err := readCacheExport(bytes.NewReader(data))
+	assert.NoError(t, err)
+	export.Commits["1111111111111111111111111111111111111111"] = object.FileStats{{Name: "other.txt", Addition: 5}}
+	data, err = json.Marshal(export)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(exportPath, data, 0644))
+
+	// Import into an empty cache on "another machine"
+	otherCache := t.TempDir()
+	getCacheDirFn = func() (string, error) {
+		return otherCache, nil
+	}
+	output = captureStdout(func() { runCacheImport(nil, []string{exportPath, repoDir}) })
+	assert.Equal(t, "Imported 1 commits\nSkipped 1 commits not found in the given repositories\n", output)
+
+	store, err = openCacheStore()
+	assert.NoError(t, err)
+	keys, err := store.Keys(commitsBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{head}, keys)
+
+	// Imported stats are used instead of diffing the commit again
+	assert.NoError(t, putCommitStats(store, head, object.FileStats{{Name: "test.txt", Addition: 7}}))
+	assert.Equal(t, "+7/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+
+	// Clearing the whole cache removes commit stats too
+	captureStdout(func() { runCacheClear(nil, nil) })
+	keys, err = store.Keys(commitsBucket)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// Exports from a newer grit, and files that aren't exports, are refused
+	_, err = readCacheExport(strings.NewReader(`{"Format":"grit-cache-export","Version":99}`))
+	assert.EqualError(t, err, "unsupported export version 99 (this grit reads version 1)")
+	_, err = readCacheExport(strings.NewReader(`{"Entries":[]}`))
+	assert.EqualError(t, err, "not a grit cache export")
+}
+
+func TestDescribeCacheArgs(t *testing.T) {
+	defaults := CacheArgs{
+		DateField:        "author",
+		CoauthorCredit:   "full",
+		CoauthorTrailers: []string{defaultCoauthorTrailer},
+		IssueRegex:       defaultIssueRegex,
+	}
+	assert.Equal(t, "-", describeCacheArgs(defaults))
+
+	// Entries differing only in the co-author trailers or issue regex are
+	// told apart
+	args := defaults
+	args.CoauthorTrailers = []string{defaultCoauthorTrailer, "Paired-with"}
+	args.GroupBy = "issue"
+	args.IssueRegex = `PLAT-[0-9]+`
+	assert.Equal(t, "--coauthor-trailer=Co-authored-by --coauthor-trailer=Paired-with --by=issue --issue-regex=PLAT-[0-9]+", describeCacheArgs(args))
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheExportCmd = &cobra.Command{
+		Use:   "export [file]",
+		Short: "Export cached per-commit stats to a file, or stdout",
+		Long: `Export the cached line changes of individual commits to a file, or to stdout
+if no file (or "-") is given. Commits are identified by hash, so the export can
+be imported on another machine with grit cache import.
+
+Results of whole queries are tied to local paths and are not exported.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  runCacheExport,
+	}
+	cacheImportCmd = &cobra.Command{
+		Use:   "import <file> [repositories...]",
+		Short: "Import per-commit stats exported by grit cache export",
+		Long: `Import the per-commit stats in a file written by grit cache export, or from
+stdin if the file is "-". Only commits found in one of the given repositories
+(default: the current directory) are imported.`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  runCacheImport,
+	}
+)
+
+const (
+	// exportFormat identifies files written by grit cache export
+	exportFormat = "grit-cache-export"
+	// exportVersion is the version of the export format written by this grit.
+	// Files with a newer version are refused rather than misread.
+	exportVersion = 1
+)
+
+// cacheExport is the portable form of the per-commit stats cache
+type cacheExport struct {
+	Format  string
+	Version int
+	Commits map[string]object.FileStats // commit hash -> stats
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheExportCmd, cacheImportCmd)
+}
+
+func runCacheExport(cmd *cobra.Command, args []string) {
+	store, err := openCacheStore()
+	if err != nil {
+		fmt.Printf("Error opening cache: %v\n", err)
+		return
+	}
+
+	export, err := exportCommitStats(store)
+	if err != nil {
+		fmt.Printf("Error reading cache: %v\n", err)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Create(args[0])
+		if err != nil {
+			fmt.Printf("Error creating export file: %v\n", err)
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		fmt.Printf("Error writing export: %v\n", err)
+		return
+	}
+	if w != os.Stdout {
+		fmt.Printf("Exported %d commits\n", len(export.Commits))
+	}
+}
+
+func runCacheImport(cmd *cobra.Command, args []string) {
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("Error opening export file: %v\n", err)
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	export, err := readCacheExport(r)
+	if err != nil {
+		fmt.Printf("Error reading export: %v\n", err)
+		return
+	}
+
+	repositories := args[1:]
+	if len(repositories) == 0 {
+		repositories = []string{"./"}
+	}
+	var repos []*git.Repository
+	for _, path := range repositories {
+		repo, err := git.PlainOpen(path)
+		if err != nil {
+			fmt.Printf("Error opening repository at %s: %v\n", path, err)
+			return
+		}
+		repos = append(repos, repo)
+	}
+
+	store, err := openCacheStore()
+	if err != nil {
+		fmt.Printf("Error opening cache: %v\n", err)
+		return
+	}
+
+	imported, unknown, err := importCommitStats(store, export, repos)
+	if err != nil {
+		fmt.Printf("Error updating cache: %v\n", err)
+		return
+	}
+	fmt.Printf("Imported %d commits\n", imported)
+	if unknown > 0 {
+		fmt.Printf("Skipped %d commits not found in the given repositories\n", unknown)
+	}
+}
+
+// exportCommitStats collects every commit's stats from the store
+func exportCommitStats(store kvStore) (*cacheExport, error) {
+	keys, err := store.Keys(commitsBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &cacheExport{
+		Format:  exportFormat,
+		Version: exportVersion,
+		Commits: make(map[string]object.FileStats, len(keys)),
+	}
+	for _, key := range keys {
+		stats, err := getCommitStats(store, key)
+		if err != nil {
+			return nil, err
+		}
+		if stats != nil {
+			export.Commits[key] = stats
+		}
+	}
+	return export, nil
+}
+
+// readCacheExport decodes an export, refusing anything that is not an export
+// or was written by a newer grit
+func readCacheExport(r io.Reader) (*cacheExport, error) {
+	var export cacheExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	if export.Format != exportFormat {
+		return nil, fmt.Errorf("not a grit cache export")
+	}
+	if export.Version < 1 || export.Version > exportVersion {
+		return nil, fmt.Errorf("unsupported export version %d (this grit reads version %d)", export.Version, exportVersion)
+	}
+	return &export, nil
+}
+
+// importCommitStats stores the stats of every exported commit that exists in
+// one of the repositories, and returns how many were imported and how many
+// were not found. Stats for commits the local object database doesn't have
+// could never be used, and can't be trusted.
+func importCommitStats(store kvStore, export *cacheExport, repos []*git.Repository) (int, int, error) {
+	var imported, unknown int
+	for hash, stats := range export.Commits {
+		if !plumbing.IsHash(hash) || !commitExists(repos, plumbing.NewHash(hash)) {
+			unknown++
+			continue
+		}
+		if err := putCommitStats(store, hash, stats); err != nil {
+			return imported, unknown, err
+		}
+		imported++
+	}
+	return imported, unknown, nil
+}
+
+// commitExists reports whether any of the repositories has the commit
+func commitExists(repos []*git.Repository, hash plumbing.Hash) bool {
+	for _, repo := range repos {
+		if _, err := repo.CommitObject(hash); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// withCacheLock runs f while holding an exclusive lock on the cache
+func withCacheLock(f func() error) error {
+	dir, err := getCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(filepath.Join(dir, "lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	return f()
+}
+
+// updateCache applies update to the latest cache on disk and saves the
+// result, holding the cache lock throughout so concurrent updates are not lost
+func updateCache(update func(cache *Cache)) error {
+	return withCacheLock(func() error {
+		cache, err := loadCache()
+		if err != nil {
+			return err
+		}
+		update(cache)
+		return saveCache(cache)
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package cmd
+
+import "os"
+
+// lockFile is a no-op on platforms without file locking; writes are still
+// atomic, but concurrent updates may be lost
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without file locking
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheSchemaVersion is the version of the cache format written by this grit.
+// Entries record the version they were written with and are migrated forward
+// when read; entries from a newer grit are ignored and left alone.
+//
+//	0: a single JSON file, ~/.grit-cache.json, holding every entry
+//	1: one file per entry in the cache directory, without a version
+//	2: entries record their schema version
+//	3: adds Pathspecs to CacheArgs
+//	4: adds Pickaxe and PickaxeRegex to CacheArgs
+//	5: adds Follow to CacheArgs
+//	6: counts breaking changes in breakdowns by type
+//	7: credits branch issue keys only to the branch's own commits
+//	8: splits the lines of commits naming several issue keys between them
+const cacheSchemaVersion = 8
+
+// cacheMigrations[v] upgrades an entry from version v to v+1. Adding a field
+// to CacheArgs changes every cache key, so it needs a new version with a
+// migration that fills in the field's default.
+var cacheMigrations = []func(entry *CacheEntry){
+	migrateHomeFileEntry,
+	func(entry *CacheEntry) {}, // version 2 only adds the version itself
+	func(entry *CacheEntry) {}, // no pathspecs could be given before version 3
+	func(entry *CacheEntry) {}, // nor a pickaxe before version 4
+	func(entry *CacheEntry) {}, // nor a file to follow before version 5
+	expireBreakdown("type"),
+	expireBreakdown("issue"),
+	expireBreakdown("issue"),
+}
+
+// schemaKey records, in the meta bucket, the version the store has been
+// migrated to
+const schemaKey = "schema"
+
+// legacyCacheFileName is the cache file that grit kept in the home directory
+// before version 1
+const legacyCacheFileName = ".grit-cache.json"
+
+var legacyCachePathFn = defaultLegacyCachePath
+
+// defaultLegacyCachePath returns where grit kept its cache before version 1
+func defaultLegacyCachePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, legacyCacheFileName), nil
+}
+
+// upgradeCacheEntry migrates an entry to the current version. It returns
+// false if the entry was written by a newer grit and can't be used.
+func upgradeCacheEntry(entry *CacheEntry) bool {
+	if entry.Version > cacheSchemaVersion {
+		return false
+	}
+	for entry.Version < cacheSchemaVersion {
+		cacheMigrations[entry.Version](entry)
+		entry.Version++
+	}
+	return true
+}
+
+// migrateHomeFileEntry upgrades an entry from the single cache file. Those
+// entries predate every filter flag except --author-regex, --remote,
+// --filenames-regex and --week-to-date, and recorded no time window.
+func migrateHomeFileEntry(entry *CacheEntry) {
+	if entry.Args.DateField == "" {
+		entry.Args.DateField = "author"
+	}
+	if entry.Args.CoauthorCredit == "" {
+		entry.Args.CoauthorCredit = "full"
+	}
+	if entry.Args.CoauthorTrailers == nil {
+		entry.Args.CoauthorTrailers = []string{defaultCoauthorTrailer}
+	}
+	if entry.Args.IssueRegex == "" {
+		entry.Args.IssueRegex = defaultIssueRegex
+	}
+	if entry.WindowStart.IsZero() {
+		entry.WindowStart, entry.WindowEnd = countWindow(entry.Timestamp, entry.Args.WeekToDate)
+	}
+}
+
+// expireBreakdown returns a migration that marks entries broken down by a
+// group as expired, for when that breakdown changes in a way that can't be
+// worked out from the stored results
+func expireBreakdown(by string) func(entry *CacheEntry) {
+	return func(entry *CacheEntry) {
+		if entry.Args.GroupBy == by {
+			entry.Timestamp = time.Time{}
+		}
+	}
+}
+
+// migrateCacheStore brings a store up to the current version: entries from
+// the old home directory file are moved in, and entries whose key changed
+// are moved to their new key. Every step can safely be repeated, so
+// concurrent runs don't need to hold the cache lock.
+func migrateCacheStore(store kvStore) error {
+	var schema struct{ Version int }
+	data, err := store.Get(metaBucket, schemaKey)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &schema); err == nil && schema.Version >= cacheSchemaVersion {
+			return nil
+		}
+	}
+
+	if err := migrateHomeFile(store); err != nil {
+		return err
+	}
+
+	keys, err := store.Keys(entriesBucket)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		entry, err := getCacheEntry(store, key)
+		if err != nil {
+			return err
+		}
+		if entry == nil || entry.key() == key {
+			continue
+		}
+		if err := putCacheEntry(store, *entry); err != nil {
+			return err
+		}
+		if err := store.Delete(entriesBucket, key); err != nil {
+			return err
+		}
+	}
+
+	data, err = json.Marshal(struct{ Version int }{cacheSchemaVersion})
+	if err != nil {
+		return err
+	}
+	return store.Put(metaBucket, schemaKey, data)
+}
+
+// migrateHomeFile moves the entries of the old cache file into the store,
+// without replacing newer results, and removes the file
+func migrateHomeFile(store kvStore) error {
+	path, err := legacyCachePathFn()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var legacy struct {
+		Entries []CacheEntry
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		// Nothing can be recovered from a corrupted file
+		return removeHomeFile(path)
+	}
+
+	for _, entry := range legacy.Entries {
+		entry.Version = 0
+		upgradeCacheEntry(&entry)
+		existing, err := getCacheEntry(store, entry.key())
+		if err != nil {
+			return err
+		}
+		if existing != nil && !existing.Timestamp.Before(entry.Timestamp) {
+			continue
+		}
+		if err := putCacheEntry(store, entry); err != nil {
+			return err
+		}
+	}
+	return removeHomeFile(path)
+}
+
+// removeHomeFile removes the old cache file once it has been migrated.
+// Another grit may have migrated and removed it at the same time, which is
+// just as good.
+func removeHomeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
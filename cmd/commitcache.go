@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitsBucket holds the line changes of individual commits, keyed by
+// commit hash. Commits are immutable, so these never need invalidating and
+// can be shared between machines with grit cache export and import.
+const commitsBucket = "commits"
+
+// cachedCommitStats returns a function that diffs a commit only if its stats
+// are not already in the store, and stores them if not. Failing to store the
+// stats only loses the optimisation, so it is not reported.
+func cachedCommitStats(store kvStore) func(c *object.Commit) (object.FileStats, error) {
+	return func(c *object.Commit) (object.FileStats, error) {
+		if stats, err := getCommitStats(store, c.Hash.String()); err == nil && stats != nil {
+			return stats, nil
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			return nil, err
+		}
+		putCommitStats(store, c.Hash.String(), stats)
+		return stats, nil
+	}
+}
+
+// getCommitStats reads the stats of a commit, or returns nil if they are not
+// stored or can't be read
+func getCommitStats(store kvStore, hash string) (object.FileStats, error) {
+	data, err := store.Get(commitsBucket, hash)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	stats := object.FileStats{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, nil
+	}
+	return stats, nil
+}
+
+// putCommitStats stores the stats of a commit
+func putCommitStats(store kvStore, hash string, stats object.FileStats) error {
+	if stats == nil {
+		// Store commits that changed no files as such, not as missing
+		stats = object.FileStats{}
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return store.Put(commitsBucket, hash, data)
+}
+
+// clearCommitStats removes the stats of every commit
+func clearCommitStats() error {
+	return clearBucket(commitsBucket)
+}
+
+// pruneBucket removes the keys of a bucket that haven't been used since
+// before, returning how many were removed
+func pruneBucket(store kvStore, bucket string, before time.Time) (int, error) {
+	keys, err := store.Keys(bucket)
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for _, key := range keys {
+		used, err := store.Used(bucket, key)
+		if err != nil {
+			return removed, err
+		}
+		if used.IsZero() || !used.Before(before) {
+			continue
+		}
+		if err := store.Delete(bucket, key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// clearBucket removes everything in a bucket of the cache store
+func clearBucket(bucket string) error {
+	store, err := openCacheStore()
+	if err != nil {
+		return err
+	}
+	keys, err := store.Keys(bucket)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+)
+
+// conventionalHeaderRe matches a Conventional Commits header such as
+// "feat(parser)!: support trailers"
+var conventionalHeaderRe = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^)]*)\))?(!)?: \S`)
+
+// conventionalCommit holds the parts of a Conventional Commits message
+type conventionalCommit struct {
+	Type     string
+	Scope    string
+	Breaking bool
+}
+
+// parseConventionalCommit parses the header and footers of a commit message.
+// Messages that don't follow the convention have type "other".
+func parseConventionalCommit(message string) conventionalCommit {
+	header, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	m := conventionalHeaderRe.FindStringSubmatch(header)
+	if m == nil {
+		return conventionalCommit{Type: "other"}
+	}
+
+	cc := conventionalCommit{
+		Type:     strings.ToLower(m[1]),
+		Scope:    strings.TrimSpace(m[2]),
+		Breaking: m[3] == "!",
+	}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			cc.Breaking = true
+		}
+	}
+	return cc
+}
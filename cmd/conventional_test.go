@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	tests := []struct {
+		message string
+		want    conventionalCommit
+	}{
+		{"feat: add --grep", conventionalCommit{Type: "feat"}},
+		{"fix(cache): handle missing file\n\nDetails", conventionalCommit{Type: "fix", Scope: "cache"}},
+		{"Refactor!: drop the old flags", conventionalCommit{Type: "refactor", Breaking: true}},
+		{"feat(log)!: new format", conventionalCommit{Type: "feat", Scope: "log", Breaking: true}},
+		{"chore: bump deps\n\nBREAKING CHANGE: needs Go 1.24", conventionalCommit{Type: "chore", Breaking: true}},
+		{"Update README", conventionalCommit{Type: "other"}},
+		{"feat:missing space", conventionalCommit{Type: "other"}},
+		{"Merge branch 'main': sync", conventionalCommit{Type: "other"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseConventionalCommit(tt.message))
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pollInterval time.Duration
+	noDaemon     bool
+	daemonCmd    = &cobra.Command{
+		Use:   "daemon",
+		Short: "Keep repositories open and answer count lines queries over a local socket",
+		Long: `Keep repositories open and answer count lines queries over a Unix domain
+socket in the cache directory. While the daemon is running, grit count lines
+asks it instead of reading the repositories itself, unless it takes longer
+than --max-latency (or 30 seconds) to answer.
+
+The daemon watches the refs of every repository it has been asked about, and
+diffs new commits as they appear, so queries only walk history. It keeps the
+line changes of up to 200,000 commits per repository in memory, and saves
+them to the cache as grit count lines does, so older ones are read back
+rather than diffed again.`,
+		Args:        cobra.NoArgs,
+		Run:         runDaemon,
+		Annotations: map[string]string{noPagerAnnotation: "true"},
+	}
+)
+
+// daemonDialTimeout is how long a command waits to connect to the daemon
+// before computing the result itself
+const daemonDialTimeout = 100 * time.Millisecond
+
+// daemonStatsLimit is how many commits' stats the daemon keeps in memory for
+// each repository, in each of the two halves of its statsCache
+const daemonStatsLimit = 100000
+
+// daemonQueryTimeout is how long a command waits for the daemon's answer,
+// unless --max-latency is shorter, before computing the result itself
+const daemonQueryTimeout = 30 * time.Second
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().DurationVar(&pollInterval, "poll-interval", 2*time.Second, "How often to check repositories for new commits")
+}
+
+// daemonRequest is a count lines query sent to the daemon
+type daemonRequest struct {
+	Paths []string
+	Args  CacheArgs
+}
+
+// daemonResponse is the daemon's answer to a query. Output holds anything
+// the query printed, such as repositories that couldn't be read.
+type daemonResponse struct {
+	Results CacheResults
+	Output  string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// daemonSocketPath returns the socket the daemon listens on
+func daemonSocketPath() (string, error) {
+	dir, err := getCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon.sock"), nil
+}
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	path, err := daemonSocketPath()
+	if err != nil {
+		fmt.Printf("Error finding daemon socket: %v\n", err)
+		return
+	}
+
+	l, err := listenDaemon(path)
+	if err != nil {
+		fmt.Printf("Error starting daemon: %v\n", err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	d := newDaemon()
+	go d.watch(ctx, pollInterval)
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	fmt.Printf("Listening on %s\n", path)
+	d.serve(l)
+}
+
+// listenDaemon listens on the socket at path, replacing a socket left behind
+// by a daemon that is no longer running
+func listenDaemon(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if conn, err := net.DialTimeout("unix", path, daemonDialTimeout); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// daemon keeps repositories open between queries and remembers the line
+// changes of the commits it has diffed in each. Queries of different
+// repositories run at the same time; d.mu is only held to look up or record a
+// repository.
+type daemon struct {
+	mu    sync.Mutex
+	repos map[string]*daemonRepo
+	diff  func(c *object.Commit) (object.FileStats, error) // diffs commits not in memory
+}
+
+// daemonRepo is a repository the daemon keeps open. A go-git repository
+// can't be read from several goroutines at once, so queries hold mu while
+// they walk it. Its commits' stats are forgotten with it.
+type daemonRepo struct {
+	mu    sync.Mutex
+	repo  *git.Repository
+	refs  map[plumbing.ReferenceName]plumbing.Hash // refs last seen
+	stats *statsCache
+}
+
+// newDaemon returns a daemon with no repositories open. Commits it diffs are
+// saved to the cache store, if it can be opened, and read back from it.
+func newDaemon() *daemon {
+	d := &daemon{
+		repos: make(map[string]*daemonRepo),
+		diff:  func(c *object.Commit) (object.FileStats, error) { return c.Stats() },
+	}
+	if store, err := openCacheStore(); err == nil {
+		d.diff = cachedCommitStats(store)
+	}
+	return d
+}
+
+// statsCache remembers the line changes of a repository's commits, holding at
+// most twice limit of them. When the newer half fills up the older half is
+// dropped, so the commits queries keep asking for stay.
+type statsCache struct {
+	mu     sync.Mutex
+	limit  int
+	recent map[plumbing.Hash]object.FileStats
+	older  map[plumbing.Hash]object.FileStats
+}
+
+func newStatsCache(limit int) *statsCache {
+	return &statsCache{limit: limit, recent: make(map[plumbing.Hash]object.FileStats)}
+}
+
+// get returns the remembered stats of a commit, if it has been diffed
+func (s *statsCache) get(hash plumbing.Hash) (object.FileStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.recent[hash]; ok {
+		return stats, true
+	}
+	stats, ok := s.older[hash]
+	if ok {
+		s.add(hash, stats)
+	}
+	return stats, ok
+}
+
+// put remembers the stats of a commit
+func (s *statsCache) put(hash plumbing.Hash, stats object.FileStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(hash, stats)
+}
+
+// add records stats in the newer half, first dropping the older half if the
+// newer one is full. s.mu must be held.
+func (s *statsCache) add(hash plumbing.Hash, stats object.FileStats) {
+	if len(s.recent) >= s.limit {
+		s.older, s.recent = s.recent, make(map[plumbing.Hash]object.FileStats)
+	}
+	s.recent[hash] = stats
+}
+
+// len returns how many commits' stats are remembered
+func (s *statsCache) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.recent) + len(s.older)
+}
+
+// serve answers queries until the listener is closed
+func (d *daemon) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle answers a single query
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req daemonRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	json.NewEncoder(conn).Encode(d.query(req))
+}
+
+// query counts lines as count lines would, using the open repositories and
+// remembered commit stats
+func (d *daemon) query(req daemonRequest) daemonResponse {
+	q, err := newLinesQuery(req.Paths, req.Args)
+	if err != nil {
+		return daemonResponse{Error: err.Error()}
+	}
+
+	// Hold every repository the query reads, in path order so that queries
+	// sharing repositories can't deadlock
+	var paths []string
+	for _, pathSpec := range req.Paths {
+		paths = append(paths, parseRevisionSpec(pathSpec).Path)
+	}
+	sort.Strings(paths)
+	repos := make(map[string]*daemonRepo)
+	errs := make(map[string]error)
+	for _, path := range paths {
+		if _, ok := repos[path]; ok || errs[path] != nil {
+			continue
+		}
+		r, err := d.open(path)
+		if err != nil {
+			errs[path] = err
+			continue
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		repos[path] = r
+	}
+
+	// Repositories are walked one at a time, each after it is opened
+	var out bytes.Buffer
+	var current *daemonRepo
+	q.out = &out
+	q.open = func(path string) (*git.Repository, error) {
+		if err := errs[path]; err != nil {
+			return nil, err
+		}
+		current = repos[path]
+		return current.repo, nil
+	}
+	q.selection.stats = func(c *object.Commit) (object.FileStats, error) {
+		return d.commitStats(current, c)
+	}
+	entry := q.count(timeNow())
+
+	return daemonResponse{Results: entry.Results, Output: out.String()}
+}
+
+// open returns the repository at path, opening and starting to watch it the
+// first time it is asked for
+func (d *daemon) open(path string) (*daemonRepo, error) {
+	d.mu.Lock()
+	r, ok := d.repos[path]
+	d.mu.Unlock()
+	if ok {
+		return r, nil
+	}
+
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repoRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Another query may have opened it meanwhile
+	if r, ok := d.repos[path]; ok {
+		return r, nil
+	}
+	r = &daemonRepo{repo: repo, refs: refs, stats: newStatsCache(daemonStatsLimit)}
+	d.repos[path] = r
+	return r, nil
+}
+
+// commitStats returns the line changes of a commit of r, diffing it only if
+// it isn't remembered. Commits are immutable, so the result never goes stale.
+// The diff is worked out without holding r.stats.mu, so a query and a refresh
+// may occasionally both diff a commit.
+func (d *daemon) commitStats(r *daemonRepo, c *object.Commit) (object.FileStats, error) {
+	if stats, ok := r.stats.get(c.Hash); ok {
+		return stats, nil
+	}
+	stats, err := d.diff(c)
+	if err != nil {
+		return nil, err
+	}
+	r.stats.put(c.Hash, stats)
+	return stats, nil
+}
+
+// watch checks the open repositories for moved refs every interval until ctx
+// is cancelled
+func (d *daemon) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh()
+		}
+	}
+}
+
+// refresh checks the open repositories for moved refs. A repository whose
+// refs have moved is reopened, so that new objects and packs are seen, and
+// its commits since the start of the week are diffed ahead of the next query.
+// The diffing is done on the new copy before it replaces the old one, so
+// queries carry on meanwhile.
+func (d *daemon) refresh() {
+	d.mu.Lock()
+	repos := make(map[string]*daemonRepo, len(d.repos))
+	for path, r := range d.repos {
+		repos[path] = r
+	}
+	d.mu.Unlock()
+
+	weekStart, _ := countWindow(timeNow(), true)
+	for path, r := range repos {
+		// A repository being queried is checked on a later pass
+		if !r.mu.TryLock() {
+			continue
+		}
+		refs, err := repoRefs(r.repo)
+		moved := err == nil && !refsEqual(refs, r.refs)
+		r.mu.Unlock()
+		if err != nil {
+			// The repository has gone; forget it until it is asked for again
+			d.mu.Lock()
+			if d.repos[path] == r {
+				delete(d.repos, path)
+			}
+			d.mu.Unlock()
+			continue
+		}
+		if !moved {
+			continue
+		}
+
+		repo, err := git.PlainOpen(path)
+		if err != nil {
+			continue
+		}
+		for _, hash := range refs {
+			d.warm(r, repo, hash, weekStart)
+		}
+		r.mu.Lock()
+		r.repo, r.refs = repo, refs
+		r.mu.Unlock()
+	}
+}
+
+// warm diffs the commits of r reachable from hash back to since, stopping
+// early at commits that have already been diffed. repo is a copy of r's
+// repository, which queries may be reading meanwhile.
+func (d *daemon) warm(r *daemonRepo, repo *git.Repository, hash plumbing.Hash, since time.Time) {
+	commits, err := repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return
+	}
+	commits.ForEach(func(c *object.Commit) error {
+		if _, ok := r.stats.get(c.Hash); ok || c.Committer.When.Before(since) {
+			return storer.ErrStop
+		}
+		if len(c.ParentHashes) <= 1 {
+			d.commitStats(r, c)
+		}
+		return nil
+	})
+}
+
+// repoRefs returns the hash every ref in a repository points at, with
+// symbolic refs such as HEAD resolved
+func repoRefs(repo *git.Repository) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.SymbolicReference {
+			resolved, err := repo.Reference(ref.Name(), true)
+			if err != nil {
+				return nil
+			}
+			ref = resolved
+		}
+		refs[ref.Name()] = ref.Hash()
+		return nil
+	})
+	return refs, err
+}
+
+// refsEqual reports whether two ref snapshots are the same
+func refsEqual(a, b map[plumbing.ReferenceName]plumbing.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, hash := range a {
+		if other, ok := b[name]; !ok || other != hash {
+			return false
+		}
+	}
+	return true
+}
+
+// queryDaemon asks a running daemon for a count lines result. It returns an
+// error if no daemon is listening or it doesn't answer within timeout, in
+// which case the caller should compute the result itself.
+func queryDaemon(paths []string, args CacheArgs, timeout time.Duration) (*daemonResponse, error) {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", path, daemonDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	// The daemon runs in its own working directory
+	absPaths := make([]string, len(paths))
+	for i, pathSpec := range paths {
+		spec := parseRevisionSpec(pathSpec)
+		if spec.Path, err = filepath.Abs(spec.Path); err != nil {
+			return nil, err
+		}
+		absPaths[i] = spec.String()
+	}
+
+	if err := json.NewEncoder(conn).Encode(daemonRequest{Paths: absPaths, Args: args}); err != nil {
+		return nil, err
+	}
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
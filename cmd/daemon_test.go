@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDaemon(t *testing.T) {
+	repoDir, _ := setupCacheCmdTest(t)
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = true
+	defer func() { noCache = false }()
+
+	path, err := daemonSocketPath()
+	assert.NoError(t, err)
+	l, err := listenDaemon(path)
+	assert.NoError(t, err)
+	d := newDaemon()
+	go d.serve(l)
+	defer l.Close()
+
+	// A second daemon refuses to start
+	_, err = listenDaemon(path)
+	assert.Error(t, err)
+
+	// count lines is answered by the daemon, which opens the repository and
+	// remembers the commit's stats
+	assert.Equal(t, "+2/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	d.mu.Lock()
+	assert.Len(t, d.repos, 1)
+	r := d.repos[repoDir]
+	d.mu.Unlock()
+	assert.Equal(t, 1, r.stats.len())
+
+	// Relative paths are resolved before they are sent
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(repoDir))
+	defer os.Chdir(wd)
+	assert.Equal(t, "+2/-0", captureStdout(func() { runLines(nil, []string{"./@master"}) }))
+
+	// New commits are picked up and diffed when the refs are next checked
+	repo, err := git.PlainOpen(repoDir)
+	assert.NoError(t, err)
+	w, err := repo.Worktree()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("one\ntwo\nthree\n"), 0644))
+	_, err = w.Add("test.txt")
+	assert.NoError(t, err)
+	_, err = w.Commit("Second commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test Author", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	d.refresh()
+	assert.Equal(t, 2, r.stats.len())
+	assert.Equal(t, "+3/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+
+	// Errors are reported as they would be without the daemon
+	assert.Equal(t, "Error opening repository at "+filepath.Join(repoDir, "missing")+": repository does not exist\n+0/-0",
+		captureStdout(func() { runLines(nil, []string{filepath.Join(repoDir, "missing")}) }))
+
+	// --no-daemon computes the result locally
+	noDaemon = true
+	defer func() { noDaemon = false }()
+	assert.Equal(t, "+3/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+}
+
+func TestDaemonStatsCache(t *testing.T) {
+	s := newStatsCache(2)
+	hashes := make([]plumbing.Hash, 5)
+	for i := range hashes {
+		hashes[i] = plumbing.NewHash(fmt.Sprintf("%040d", i))
+	}
+
+	// Once the newer half is full, it becomes the older half
+	s.put(hashes[0], object.FileStats{})
+	s.put(hashes[1], object.FileStats{})
+	s.put(hashes[2], object.FileStats{})
+	assert.Equal(t, 3, s.len())
+
+	// Commits asked for again are kept, while the rest are dropped
+	_, ok := s.get(hashes[0])
+	assert.True(t, ok)
+	s.put(hashes[3], object.FileStats{})
+	s.put(hashes[4], object.FileStats{})
+	assert.Equal(t, 4, s.len())
+	for i, want := range []bool{true, false, true, true, true} {
+		_, recent := s.recent[hashes[i]]
+		_, older := s.older[hashes[i]]
+		assert.Equal(t, want, recent || older, "commit %d", i)
+	}
+}
+
+func TestDaemonReadsSavedStats(t *testing.T) {
+	repoDir, head := setupCacheCmdTest(t)
+
+	// Stats the daemon has forgotten, or a previous daemon diffed, are read
+	// back from the cache rather than diffed again
+	store, err := openCacheStore()
+	assert.NoError(t, err)
+	assert.NoError(t, putCommitStats(store, head, object.FileStats{{Name: "test.txt", Addition: 5}}))
+
+	d := newDaemon()
+	args := CacheArgs{DateField: "author", CoauthorCredit: "full", IssueRegex: defaultIssueRegex}
+	resp := d.query(daemonRequest{Paths: []string{repoDir}, Args: args})
+	assert.Empty(t, resp.Error)
+	assert.Equal(t, int64(5), resp.Results.Added)
+}
+
+func TestDaemonTimeout(t *testing.T) {
+	repoDir, _ := setupCacheCmdTest(t)
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = true
+	defer func() {
+		noCache = false
+		maxLatency = 0
+	}()
+
+	// A daemon that accepts queries but never answers them
+	path, err := daemonSocketPath()
+	assert.NoError(t, err)
+	l, err := listenDaemon(path)
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = queryDaemon([]string{repoDir}, flagArgs(), 20*time.Millisecond)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// count lines gives up on it within --max-latency and counts itself
+	maxLatency = 20 * time.Millisecond
+	start = time.Now()
+	assert.Equal(t, "+2/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDaemonQueriesDontWaitForOtherRepositories(t *testing.T) {
+	repoDir, _ := setupCacheCmdTest(t)
+	otherDir := setupPickaxeRepo(t, time.Now())
+
+	d := newDaemon()
+	args := CacheArgs{DateField: "author", CoauthorCredit: "full", IssueRegex: defaultIssueRegex}
+	busy, err := d.open(otherDir)
+	assert.NoError(t, err)
+	busy.mu.Lock()
+	defer busy.mu.Unlock()
+
+	// A query of another repository, or a refresh, isn't held up by a
+	// long query of the busy one
+	done := make(chan daemonResponse)
+	go func() {
+		d.refresh()
+		done <- d.query(daemonRequest{Paths: []string{repoDir}, Args: args})
+	}()
+	select {
+	case resp := <-done:
+		assert.Empty(t, resp.Error)
+		assert.Equal(t, int64(2), resp.Results.Added)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query waited for a repository it doesn't read")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package cmd
+
+import "os/exec"
+
+// detachProcess does nothing on platforms without sessions
+func detachProcess(cmd *exec.Cmd) {}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// statWidth is the width --stat lines are fitted into, as in git
+const statWidth = 80
+
+// ANSI colours used in human-oriented output
+const (
+	colorReset  = "\x1b[0m"
+	colorGreen  = "\x1b[32m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+)
+
+var colorMode string
+
+// validateColorMode checks a --color value
+func validateColorMode(mode string) error {
+	switch mode {
+	case "auto", "always", "never":
+		return nil
+	}
+	return fmt.Errorf("invalid color mode %q (must be auto, always or never)", mode)
+}
+
+// useColor decides whether to colour output to f: always, never, or, in auto
+// mode, when f is a terminal and NO_COLOR is not set
+func useColor(mode string, f *os.File) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// colorEnabled reports whether human-oriented output should be coloured,
+// as chosen by --color for the terminal it ends up on
+func colorEnabled() bool {
+	return useColor(colorMode, terminalStdout())
+}
+
+// colorize wraps s in an ANSI colour if color is set
+func colorize(s, code string, color bool) string {
+	if !color || s == "" {
+		return s
+	}
+	return code + s + colorReset
+}
+
+// colorCounts formats lines added and deleted as "+added/-deleted", in green
+// and red if color is set
+func colorCounts(added, deleted int64, color bool) string {
+	return colorize(fmt.Sprintf("+%d", added), colorGreen, color) + "/" +
+		colorize(fmt.Sprintf("-%d", deleted), colorRed, color)
+}
+
+// statLines formats per-file changes like git's --stat: each file name, its
+// total changes and a histogram bar, scaled so the longest fits in width
+func statLines(files []logFile, width int, color bool) []string {
+	nameWidth, maxChanges := 0, 0
+	for _, f := range files {
+		nameWidth = max(nameWidth, len(f.Name))
+		maxChanges = max(maxChanges, f.Added+f.Deleted)
+	}
+	countWidth := len(strconv.Itoa(maxChanges))
+
+	// " name | count " surrounds the bar
+	barWidth := max(width-nameWidth-countWidth-4, 10)
+
+	lines := make([]string, 0, len(files))
+	for _, f := range files {
+		added, deleted := f.Added, f.Deleted
+		if maxChanges > barWidth {
+			added = scaleStat(added, barWidth, maxChanges)
+			deleted = scaleStat(deleted, barWidth, maxChanges)
+		}
+		bar := colorize(strings.Repeat("+", added), colorGreen, color) +
+			colorize(strings.Repeat("-", deleted), colorRed, color)
+		lines = append(lines, fmt.Sprintf("%-*s | %*d %s", nameWidth, f.Name, countWidth, f.Added+f.Deleted, bar))
+	}
+	return lines
+}
+
+// scaleStat scales n changes to a bar of at most width characters for the
+// largest change, keeping at least one character for any change at all
+func scaleStat(n, width, maxChanges int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + n*(width-1)/maxChanges
+}
+
+// firstParentPatch returns the diff of a commit against its first parent, or
+// against nothing for a root commit. Renamed files are diffed against their
+// old selves, as in git.
+func firstParentPatch(c *object.Commit) (*object.Patch, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	parentTree := &object.Tree{}
+	if c.NumParents() != 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+	return changes.Patch()
+}
+
+// selectedPatch is a commit's patch limited to the files a selection chose
+type selectedPatch struct {
+	diff.Patch
+	files []diff.FilePatch
+}
+
+func (p selectedPatch) FilePatches() []diff.FilePatch {
+	return p.files
+}
+
+// commitPatch returns the unified diff of a selected commit against its first
+// parent, or against nothing for a root commit, limited to the selected files
+// and, with a pickaxe or --follow, to those it picked out
+func commitPatch(sc *selectedCommit, s *commitSelection, color bool) (string, error) {
+	patch, err := firstParentPatch(sc.Commit)
+	if err != nil {
+		return "", err
+	}
+
+	keep := s.selectsFile
+	if s.pickaxe != nil || s.follow != nil {
+		keep = func(name string) bool {
+			for _, stat := range sc.Files {
+				if stat.Name == name {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	selected := selectedPatch{Patch: patch}
+	for _, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		if (from != nil && keep(from.Path())) || (to != nil && keep(to.Path())) {
+			selected.files = append(selected.files, fp)
+		}
+	}
+
+	var sb strings.Builder
+	encoder := diff.NewUnifiedEncoder(&sb, diff.DefaultContextLines)
+	if color {
+		encoder.SetColor(diff.NewColorConfig())
+	}
+	if err := encoder.Encode(selected); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
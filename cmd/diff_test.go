@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatLines(t *testing.T) {
+	files := []logFile{
+		{Name: "cmd/log.go", Added: 3, Deleted: 1},
+		{Name: "README.md", Added: 0, Deleted: 2},
+	}
+	assert.Equal(t, []string{
+		"cmd/log.go | 4 +++-",
+		"README.md  | 2 --",
+	}, statLines(files, 80, false))
+
+	// Large changes are scaled to fit the width, keeping at least one
+	// character for any change
+	files = []logFile{
+		{Name: "big.txt", Added: 1000, Deleted: 500},
+		{Name: "small.txt", Added: 1, Deleted: 0},
+	}
+	lines := statLines(files, 40, false)
+	assert.Equal(t, "big.txt   | 1500 "+strings.Repeat("+", 15)+strings.Repeat("-", 8), lines[0])
+	assert.Equal(t, "small.txt |    1 +", lines[1])
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), 40)
+	}
+
+	// Colour wraps the additions and deletions separately
+	lines = statLines([]logFile{{Name: "a", Added: 1, Deleted: 1}}, 80, true)
+	assert.Equal(t, "a | 2 "+colorGreen+"+"+colorReset+colorRed+"-"+colorReset, lines[0])
+}
+
+func TestUseColor(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	assert.True(t, useColor("always", f))
+	assert.False(t, useColor("never", f))
+
+	// auto only colours terminals, and never when NO_COLOR is set
+	t.Setenv("NO_COLOR", "")
+	assert.False(t, useColor("auto", f))
+	t.Setenv("NO_COLOR", "1")
+	assert.True(t, useColor("always", f))
+
+	assert.NoError(t, validateColorMode("auto"))
+	assert.EqualError(t, validateColorMode("sometimes"), `invalid color mode "sometimes" (must be auto, always or never)`)
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	authorPatterns   []string
+	committerRegex   string
+	excludeAuthors   []string
+	excludeBots      bool
+	coauthorCredit   string
+	coauthorTrailers []string
+	grepPatterns     []string
+	invertGrep       bool
+)
+
+// defaultCoauthorTrailer is the trailer GitHub and GitLab use to credit co-authors
+const defaultCoauthorTrailer = "Co-authored-by"
+
+// botAuthorPatterns matches the authors of common automated commits
+var botAuthorPatterns = []string{
+	`\[bot\]`,
+	`(?i)^dependabot`,
+	`(?i)^renovate`,
+	`(?i)^github-actions`,
+	`(?i)^greenkeeper`,
+	`(?i)^snyk-bot`,
+	`(?i)^pre-commit-ci`,
+}
+
+// addFilterFlags registers the author, committer and message filters on a command
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&authorRegex, "author-regex", "a", "", "Regex pattern to match author name or email")
+	cmd.Flags().StringArrayVar(&authorPatterns, "author", nil, "Regex pattern to match author name or email (repeatable, OR'd with --author-regex)")
+	cmd.Flags().StringVar(&committerRegex, "committer-regex", "", "Regex pattern to match committer name or email")
+	cmd.Flags().StringArrayVar(&excludeAuthors, "exclude-author", nil, "Regex pattern of author name or email to exclude (repeatable)")
+	cmd.Flags().BoolVar(&excludeBots, "exclude-bots", false, "Exclude commits from well-known bots such as dependabot and renovate")
+	cmd.Flags().StringVar(&coauthorCredit, "coauthor-credit", "full", "How co-authors are credited: full (whole diff each), split (equal shares) or none")
+	cmd.Flags().StringArrayVar(&coauthorTrailers, "coauthor-trailer", []string{defaultCoauthorTrailer}, "Commit message trailer that names a co-author (repeatable)")
+	cmd.Flags().StringArrayVar(&grepPatterns, "grep", nil, "Regex pattern to match commit messages (repeatable, OR'd)")
+	cmd.Flags().BoolVar(&invertGrep, "invert-grep", false, "Only count commits whose message does not match --grep")
+	cmd.Flags().StringVarP(&pickaxeString, "pickaxe", "S", "", "Only count commits that change the number of occurrences of this string in a file")
+	cmd.Flags().StringVarP(&pickaxeRegex, "pickaxe-regex", "G", "", "Only count commits that add or remove lines matching this regex")
+}
+
+// credit is a contributor's claim on the lines of a commit
+type credit struct {
+	Signature object.Signature
+	slot      int // position among the commit's contributors
+	slots     int // number of equal shares the diff is split into
+}
+
+// share returns the part of n lines that belongs to this contributor. Shares
+// of the same commit always add up to exactly n.
+func (cr credit) share(n int64) int64 {
+	return evenShare(n, cr.slot, cr.slots)
+}
+
+// evenShare returns part i of n lines split into parts equal shares, as near
+// as whole lines allow. The parts always add up to exactly n.
+func evenShare(n int64, i, parts int) int64 {
+	return n*int64(i+1)/int64(parts) - n*int64(i)/int64(parts)
+}
+
+// creditedTotal returns how many of n lines belong to the credited
+// contributors as a group, counting each line at most once
+func creditedTotal(credits []credit, n int64) int64 {
+	var total int64
+	for _, cr := range credits {
+		total += cr.share(n)
+	}
+	return min(total, n)
+}
+
+// commitFilter decides which commits are counted based on who made them and
+// what their message says
+type commitFilter struct {
+	authors    []*regexp.Regexp
+	committer  *regexp.Regexp
+	excluded   []*regexp.Regexp
+	credit     string
+	trailers   []string
+	messages   []*regexp.Regexp
+	invertGrep bool
+}
+
+// newCommitFilter builds a commitFilter from the filter arguments
+func newCommitFilter(a CacheArgs) (*commitFilter, error) {
+	f := &commitFilter{credit: a.CoauthorCredit, trailers: a.CoauthorTrailers, invertGrep: a.InvertGrep}
+
+	switch a.CoauthorCredit {
+	case "full", "split", "none":
+	default:
+		return nil, fmt.Errorf("invalid co-author credit %q (must be full, split or none)", a.CoauthorCredit)
+	}
+
+	for _, pattern := range append([]string{a.AuthorRegex}, a.Authors...) {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling author regex pattern: %w", err)
+		}
+		f.authors = append(f.authors, re)
+	}
+
+	if a.CommitterRegex != "" {
+		re, err := regexp.Compile(a.CommitterRegex)
+		if err != nil {
+			return nil, fmt.Errorf("compiling committer regex pattern: %w", err)
+		}
+		f.committer = re
+	}
+
+	excluded := a.ExcludeAuthors
+	if a.ExcludeBots {
+		excluded = append(append([]string{}, excluded...), botAuthorPatterns...)
+	}
+	for _, pattern := range excluded {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling exclude-author regex pattern: %w", err)
+		}
+		f.excluded = append(f.excluded, re)
+	}
+
+	for _, pattern := range a.Grep {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling grep regex pattern: %w", err)
+		}
+		f.messages = append(f.messages, re)
+	}
+
+	return f, nil
+}
+
+// match reports whether any contributor to a commit passes the filters
+func (f *commitFilter) match(c *object.Commit) bool {
+	return len(f.credits(c)) > 0
+}
+
+// credits returns the contributors to a commit that pass the author and
+// exclusion filters, along with their share of the diff. Commits whose
+// committer or message does not match credit nobody.
+func (f *commitFilter) credits(c *object.Commit) []credit {
+	if !f.matchMessage(c.Message) {
+		return nil
+	}
+	if f.committer != nil && !signatureMatches(f.committer, c.Committer) {
+		return nil
+	}
+
+	contributors := []object.Signature{c.Author}
+	if f.credit != "none" {
+		contributors = append(contributors, coauthors(c, f.trailers)...)
+	}
+
+	slots := 1
+	if f.credit == "split" {
+		slots = len(contributors)
+	}
+
+	var credits []credit
+	for i, sig := range contributors {
+		if !f.matchContributor(sig) {
+			continue
+		}
+		cr := credit{Signature: sig, slots: slots}
+		if f.credit == "split" {
+			cr.slot = i
+		}
+		credits = append(credits, cr)
+	}
+	return credits
+}
+
+// matchMessage reports whether a commit message passes --grep and --invert-grep
+func (f *commitFilter) matchMessage(message string) bool {
+	if len(f.messages) == 0 {
+		return true
+	}
+	for _, re := range f.messages {
+		if re.MatchString(message) {
+			return !f.invertGrep
+		}
+	}
+	return f.invertGrep
+}
+
+// matchContributor reports whether a single contributor passes the author and exclusion filters
+func (f *commitFilter) matchContributor(sig object.Signature) bool {
+	for _, re := range f.excluded {
+		if signatureMatches(re, sig) {
+			return false
+		}
+	}
+
+	if len(f.authors) == 0 {
+		return true
+	}
+	for _, re := range f.authors {
+		if signatureMatches(re, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureMatches matches a regex against both the name and the email of a signature
+func signatureMatches(re *regexp.Regexp, sig object.Signature) bool {
+	return re.MatchString(sig.Name) || re.MatchString(sig.Email)
+}
+
+// coauthors parses the co-author trailers (such as "Co-authored-by: Name
+// <email>") from the last paragraph of a commit message. The commit author
+// and duplicate emails are skipped.
+func coauthors(c *object.Commit, trailers []string) []object.Signature {
+	message := strings.TrimSpace(c.Message)
+	if idx := strings.LastIndex(message, "\n\n"); idx != -1 {
+		message = message[idx+2:]
+	} else {
+		// A message without a body has no trailers
+		return nil
+	}
+
+	seen := map[string]bool{strings.ToLower(c.Author.Email): true}
+	var sigs []object.Signature
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !isCoauthorTrailer(strings.TrimSpace(key), trailers) {
+			continue
+		}
+
+		sig := parseTrailerSignature(strings.TrimSpace(value))
+		id := strings.ToLower(sig.Email)
+		if id == "" {
+			id = strings.ToLower(sig.Name)
+		}
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+// isCoauthorTrailer reports whether key is one of the configured co-author trailers
+func isCoauthorTrailer(key string, trailers []string) bool {
+	for _, trailer := range trailers {
+		if strings.EqualFold(key, trailer) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrailerSignature parses a "Name <email>" trailer value, falling back
+// to treating the whole value as a name
+func parseTrailerSignature(value string) object.Signature {
+	open := strings.LastIndex(value, "<")
+	end := strings.LastIndex(value, ">")
+	if open == -1 || end < open {
+		return object.Signature{Name: value}
+	}
+	return object.Signature{
+		Name:  strings.TrimSpace(value[:open]),
+		Email: strings.TrimSpace(value[open+1 : end]),
+	}
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitFilter(t *testing.T) {
+	defer func() {
+		authorRegex = ""
+		authorPatterns = nil
+		committerRegex = ""
+		excludeAuthors = nil
+		excludeBots = false
+	}()
+
+	commit := func(author, authorEmail, committer string) *object.Commit {
+		return &object.Commit{
+			Author:    object.Signature{Name: author, Email: authorEmail},
+			Committer: object.Signature{Name: committer, Email: committer + "@example.com"},
+		}
+	}
+
+	nathanael := commit("Nathanael Farley", "nathanael@example.com", "Nathanael Farley")
+	mirabel := commit("Mirabel Smith", "mirabel@example.com", "GitHub")
+	dependabot := commit("dependabot[bot]", "49699333+dependabot[bot]@users.noreply.github.com", "GitHub")
+	renovate := commit("Renovate Bot", "bot@renovateapp.com", "Renovate Bot")
+
+	tests := []struct {
+		name           string
+		authorRegex    string
+		authors        []string
+		committerRegex string
+		excludeAuthors []string
+		excludeBots    bool
+		want           []*object.Commit
+		wantErr        bool
+	}{
+		{
+			name: "No filters match everyone",
+			want: []*object.Commit{nathanael, mirabel, dependabot, renovate},
+		},
+		{
+			name:        "Author regex",
+			authorRegex: "Nathanael",
+			want:        []*object.Commit{nathanael},
+		},
+		{
+			name:    "Several authors are OR'd",
+			authors: []string{"Nathanael", "mirabel@"},
+			want:    []*object.Commit{nathanael, mirabel},
+		},
+		{
+			name:        "Author regex is OR'd with --author",
+			authorRegex: "Nathanael",
+			authors:     []string{"Mirabel"},
+			want:        []*object.Commit{nathanael, mirabel},
+		},
+		{
+			name:           "Committer regex",
+			committerRegex: "^GitHub$",
+			want:           []*object.Commit{mirabel, dependabot},
+		},
+		{
+			name:           "Exclude author",
+			excludeAuthors: []string{"Mirabel", "Renovate"},
+			want:           []*object.Commit{nathanael, dependabot},
+		},
+		{
+			name:        "Exclude built-in bots",
+			excludeBots: true,
+			want:        []*object.Commit{nathanael, mirabel},
+		},
+		{
+			name:        "Exclusion wins over author match",
+			authors:     []string{"Nathanael", "dependabot"},
+			excludeBots: true,
+			want:        []*object.Commit{nathanael},
+		},
+		{
+			name:    "Invalid author regex",
+			authors: []string{"("},
+			wantErr: true,
+		},
+		{
+			name:           "Invalid committer regex",
+			committerRegex: "(",
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorRegex = tt.authorRegex
+			authorPatterns = tt.authors
+			committerRegex = tt.committerRegex
+			excludeAuthors = tt.excludeAuthors
+			excludeBots = tt.excludeBots
+
+			filter, err := newCommitFilter(flagArgs())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got []*object.Commit
+			for _, c := range []*object.Commit{nathanael, mirabel, dependabot, renovate} {
+				if filter.match(c) {
+					got = append(got, c)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCoauthors(t *testing.T) {
+	c := &object.Commit{
+		Author: object.Signature{Name: "Nathanael Farley", Email: "nathanael@example.com"},
+		Message: "Pair on the parser\n\nSome body text: not a trailer.\n\n" +
+			"Co-authored-by: Mirabel Smith <mirabel@example.com>\n" +
+			"co-authored-by: Nathanael Farley <nathanael@example.com>\n" +
+			"Pair-programmed-with: Louisa <louisa@example.com>\n" +
+			"Signed-off-by: Someone Else <someone@example.com>\n" +
+			"Co-authored-by: Mirabel Smith <mirabel@example.com>\n",
+	}
+
+	assert.Equal(t, []object.Signature{
+		{Name: "Mirabel Smith", Email: "mirabel@example.com"},
+	}, coauthors(c, []string{"Co-authored-by"}))
+
+	assert.Equal(t, []object.Signature{
+		{Name: "Mirabel Smith", Email: "mirabel@example.com"},
+		{Name: "Louisa", Email: "louisa@example.com"},
+	}, coauthors(c, []string{"Co-authored-by", "Pair-programmed-with"}))
+
+	// Trailers only live in the last paragraph
+	subjectOnly := &object.Commit{Message: "Co-authored-by: Mirabel Smith <mirabel@example.com>"}
+	assert.Empty(t, coauthors(subjectOnly, []string{"Co-authored-by"}))
+}
+
+func TestCreditShares(t *testing.T) {
+	credits := []credit{{slot: 0, slots: 3}, {slot: 1, slots: 3}, {slot: 2, slots: 3}}
+
+	var sum int64
+	for _, cr := range credits {
+		sum += cr.share(10)
+	}
+	assert.Equal(t, int64(10), sum)
+	assert.Equal(t, int64(10), creditedTotal(credits, 10))
+	assert.Equal(t, int64(7), creditedTotal(credits[1:], 10))
+
+	// Full credit counts the diff once for the group
+	full := []credit{{slots: 1}, {slots: 1}}
+	assert.Equal(t, int64(10), creditedTotal(full, 10))
+}
+
+func TestCommitFilterGrep(t *testing.T) {
+	defer func() {
+		grepPatterns = nil
+		invertGrep = false
+	}()
+
+	feat := &object.Commit{Message: "feat: add --grep"}
+	fix := &object.Commit{Message: "fix(cache): handle missing file"}
+	docs := &object.Commit{Message: "Update README"}
+
+	tests := []struct {
+		name   string
+		grep   []string
+		invert bool
+		want   []*object.Commit
+	}{
+		{name: "No grep", want: []*object.Commit{feat, fix, docs}},
+		{name: "Single pattern", grep: []string{"^fix"}, want: []*object.Commit{fix}},
+		{name: "Patterns are OR'd", grep: []string{"^fix", "README"}, want: []*object.Commit{fix, docs}},
+		{name: "Invert grep", grep: []string{"^fix", "README"}, invert: true, want: []*object.Commit{feat}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grepPatterns = tt.grep
+			invertGrep = tt.invert
+
+			filter, err := newCommitFilter(flagArgs())
+			assert.NoError(t, err)
+
+			var got []*object.Commit
+			for _, c := range []*object.Commit{feat, fix, docs} {
+				if filter.match(c) {
+					got = append(got, c)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var followFile string
+
+// fileFollower traces a single file back through a history, following it
+// across renames, like git log --follow. Commits must be given to it newest
+// first, and every commit must be given, so that no rename is missed.
+type fileFollower struct {
+	start string // path of the file at the tip
+	path  string // path of the file in the commits being read; empty once its creation has been passed
+}
+
+// newFileFollower follows the file at path, relative to the repository root
+func newFileFollower(path string) *fileFollower {
+	return &fileFollower{start: path, path: path}
+}
+
+// reset starts following the file afresh, at the tip of another history
+func (f *fileFollower) reset() {
+	f.path = f.start
+}
+
+// stats returns the changes a commit made to the file, against its first
+// parent, or nil if it didn't change it. If the commit renamed the file, the
+// older commits that follow are read for its old name.
+func (f *fileFollower) stats(c *object.Commit) (object.FileStats, error) {
+	if f.path == "" {
+		return nil, nil
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := tree.FindEntry(f.path)
+	if err != nil {
+		// Not in this commit, e.g. on a branch from before it was created
+		return nil, nil
+	}
+
+	parentTree := &object.Tree{}
+	if c.NumParents() != 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	if parentEntry, err := parentTree.FindEntry(f.path); err == nil && parentEntry.Hash == entry.Hash {
+		return nil, nil
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.To.Name != f.path {
+			continue
+		}
+		patch, err := change.Patch()
+		if err != nil {
+			return nil, err
+		}
+
+		stat := object.FileStat{Name: f.path}
+		for _, s := range patch.Stats() {
+			stat.Addition += s.Addition
+			stat.Deletion += s.Deletion
+		}
+
+		// Older commits know the file by the name it was renamed from, or
+		// not at all if it was created here
+		f.path = change.From.Name
+		return object.FileStats{stat}, nil
+	}
+	return nil, nil
+}
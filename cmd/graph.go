@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// logGraph draws the branch and merge topology of a history next to its
+// commits, like git log --graph. Each lane holds the commit expected next on
+// that line of history, so commits can be drawn as they are read, newest
+// first.
+type logGraph struct {
+	lanes []string
+}
+
+// laneMove is a lane moving from one column to another between two rows
+type laneMove struct {
+	from, to int
+}
+
+// skip updates the lanes for a commit that isn't shown, so that the line
+// through it leads straight on to its parents
+func (g *logGraph) skip(hash string, parents []string) {
+	i := g.lane(hash)
+	if i < 0 {
+		return
+	}
+	g.collapse(i)
+	g.lanes, _ = g.replace(g.lane(hash), parents)
+}
+
+// render returns the rows for a shown commit: the first line of text next to
+// the commit, and the rest next to the lines leading on to its parents
+func (g *logGraph) render(hash string, parents []string, text []string) []string {
+	i := g.lane(hash)
+	if i < 0 {
+		// A branch tip no later commit leads to starts a new lane
+		g.lanes = append(g.lanes, hash)
+		i = len(g.lanes) - 1
+	}
+
+	var rows []string
+
+	// Lines from several later commits meet here
+	if moves := g.collapse(i); moves != nil {
+		rows = append(rows, transitionRows(moves)...)
+		i = g.lane(hash)
+	}
+
+	rows = append(rows, lanePrefix(len(g.lanes), i)+text[0])
+
+	lanes, moves := g.replace(i, parents)
+	g.lanes = lanes
+	rows = append(rows, transitionRows(moves)...)
+
+	prefix := lanePrefix(len(g.lanes), -1)
+	for _, line := range text[1:] {
+		rows = append(rows, strings.TrimRight(prefix+line, " "))
+	}
+	return rows
+}
+
+// lane returns the lane expecting a commit, or -1
+func (g *logGraph) lane(hash string) int {
+	for i, h := range g.lanes {
+		if h == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// collapse merges every other lane expecting the same commit as lane i into
+// it, returning how the lanes moved, or nil if none did
+func (g *logGraph) collapse(i int) []laneMove {
+	hash := g.lanes[i]
+	var lanes []string
+	var moves []laneMove
+	merged := false
+	for j, h := range g.lanes {
+		if h == hash && j != i {
+			merged = true
+			moves = append(moves, laneMove{j, -1})
+			continue
+		}
+		moves = append(moves, laneMove{j, len(lanes)})
+		lanes = append(lanes, h)
+	}
+	if !merged {
+		return nil
+	}
+
+	// Merged lanes move to wherever lane i ends up
+	target := moves[i].to
+	for k := range moves {
+		if moves[k].to < 0 {
+			moves[k].to = target
+		}
+	}
+	g.lanes = lanes
+	return moves
+}
+
+// replace returns the lanes with lane i, whose commit has been drawn, given
+// over to its parents, and how the lanes moved. The first parent continues
+// the lane; other parents not already expected open new lanes beside it.
+func (g *logGraph) replace(i int, parents []string) ([]string, []laneMove) {
+	var opened []string
+	var moves []laneMove
+	for _, p := range parents[min(1, len(parents)):] {
+		if j := g.lane(p); j >= 0 {
+			// Merging a line that is already drawn
+			moves = append(moves, laneMove{i, j})
+		} else if !slices.Contains(opened, p) {
+			opened = append(opened, p)
+		}
+	}
+
+	var lanes []string
+	for j, h := range g.lanes {
+		if j != i {
+			moves = append(moves, laneMove{j, len(lanes)})
+			lanes = append(lanes, h)
+			continue
+		}
+		if len(parents) > 0 {
+			moves = append(moves, laneMove{i, len(lanes)})
+			lanes = append(lanes, parents[0])
+		}
+		for _, p := range opened {
+			moves = append(moves, laneMove{i, len(lanes)})
+			lanes = append(lanes, p)
+		}
+	}
+	return lanes, moves
+}
+
+// lanePrefix draws a row of lanes, with the commit in lane star
+func lanePrefix(n, star int) string {
+	var sb strings.Builder
+	for k := 0; k < n; k++ {
+		if k == star {
+			sb.WriteString("* ")
+		} else {
+			sb.WriteString("| ")
+		}
+	}
+	return sb.String()
+}
+
+// transitionRows draws lanes moving between two rows of commits. As in git,
+// a lane moves at most one column per row, so one that crosses others takes
+// a row for each column. It returns no rows if no lane moved.
+func transitionRows(moves []laneMove) []string {
+	at := make([]int, len(moves))
+	for k, m := range moves {
+		at[k] = m.from
+	}
+
+	var rows []string
+	for {
+		step := make([]laneMove, len(moves))
+		for k, m := range moves {
+			next := at[k]
+			if next < m.to {
+				next++
+			} else if next > m.to {
+				next--
+			}
+			step[k] = laneMove{at[k], next}
+			at[k] = next
+		}
+		row := transitionRow(step)
+		if row == "" {
+			return rows
+		}
+		rows = append(rows, row)
+	}
+}
+
+// transitionRow draws lanes moving between two rows: straight down, or one
+// step left or right. It returns an empty string if no lane moved.
+func transitionRow(moves []laneMove) string {
+	width := 0
+	for _, m := range moves {
+		width = max(width, 2*m.from+2, 2*m.to+2)
+	}
+	row := []byte(strings.Repeat(" ", width))
+
+	moved := false
+	for _, m := range moves {
+		switch {
+		case m.from == m.to:
+			row[2*m.to] = '|'
+		case m.from < m.to:
+			row[2*m.from+1] = '\\'
+			moved = true
+		default:
+			row[2*m.from-1] = '/'
+			moved = true
+		}
+	}
+	if !moved {
+		return ""
+	}
+	return strings.TrimRight(string(row), " ")
+}
+
+// refDecorations returns the names of the branches and tags pointing at each
+// commit, as git log --decorate shows them: "HEAD -> main" for the checked
+// out branch, then other local branches, remote branches and "tag: " tags
+func refDecorations(repo *git.Repository) map[plumbing.Hash][]string {
+	type decoration struct {
+		order int
+		name  string
+	}
+	byCommit := make(map[plumbing.Hash][]decoration)
+	add := func(hash plumbing.Hash, order int, name string) {
+		byCommit[hash] = append(byCommit[hash], decoration{order, name})
+	}
+
+	var headBranch plumbing.ReferenceName
+	if head, err := repo.Head(); err == nil {
+		if head.Name().IsBranch() {
+			headBranch = head.Name()
+			add(head.Hash(), 0, "HEAD -> "+head.Name().Short())
+		} else {
+			add(head.Hash(), 0, "HEAD")
+		}
+	}
+
+	if refs, err := repo.References(); err == nil {
+		refs.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Type() != plumbing.HashReference || ref.Name() == headBranch {
+				return nil
+			}
+			switch {
+			case ref.Name().IsBranch():
+				add(ref.Hash(), 1, ref.Name().Short())
+			case ref.Name().IsRemote():
+				add(ref.Hash(), 2, ref.Name().Short())
+			case ref.Name().IsTag():
+				hash := ref.Hash()
+				// Annotated tags point at a tag object, not the commit
+				if tag, err := repo.TagObject(hash); err == nil {
+					if c, err := tag.Commit(); err == nil {
+						hash = c.Hash
+					}
+				}
+				add(hash, 3, "tag: "+ref.Name().Short())
+			}
+			return nil
+		})
+	}
+
+	decorations := make(map[plumbing.Hash][]string, len(byCommit))
+	for hash, ds := range byCommit {
+		sort.Slice(ds, func(i, j int) bool {
+			if ds[i].order != ds[j].order {
+				return ds[i].order < ds[j].order
+			}
+			return ds[i].name < ds[j].name
+		})
+		for _, d := range ds {
+			decorations[hash] = append(decorations[hash], d.name)
+		}
+	}
+	return decorations
+}
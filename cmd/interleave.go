@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// logStream is one repository's history, ordered newest first by the date
+// chosen by --date-field, with the next selected commit read ahead
+type logStream struct {
+	pathSpec string
+	commits  object.CommitIter
+	next     *selectedCommit
+}
+
+// advance reads ahead to the next selected commit, leaving next nil at the
+// end of the history
+func (s *logStream) advance(selection *commitSelection) error {
+	s.next = nil
+	for {
+		c, err := s.commits.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		sc, err := selection.selectCommit(c)
+		if err != nil {
+			return err
+		}
+		if sc != nil {
+			s.next = sc
+			return nil
+		}
+	}
+}
+
+// readAhead advances the stream, reporting whether it has another commit.
+// Errors are reported, and end the stream.
+func (s *logStream) readAhead(selection *commitSelection) bool {
+	if err := s.advance(selection); err != nil {
+		fmt.Printf("Error processing commits for repository at %s: %v\n", parseRevisionSpec(s.pathSpec).Path, err)
+		return false
+	}
+	return s.next != nil
+}
+
+// logStreamHeap orders streams by the date of their next commit, newest
+// first, and then by path spec so that the order is stable
+type logStreamHeap struct {
+	streams   []*logStream
+	dateField string
+}
+
+func (h *logStreamHeap) Len() int { return len(h.streams) }
+
+func (h *logStreamHeap) Less(i, j int) bool {
+	a := commitDate(h.streams[i].next.Commit, h.dateField)
+	b := commitDate(h.streams[j].next.Commit, h.dateField)
+	if !a.Equal(b) {
+		return a.After(b)
+	}
+	return h.streams[i].pathSpec < h.streams[j].pathSpec
+}
+
+func (h *logStreamHeap) Swap(i, j int) { h.streams[i], h.streams[j] = h.streams[j], h.streams[i] }
+
+func (h *logStreamHeap) Push(x interface{}) { h.streams = append(h.streams, x.(*logStream)) }
+
+func (h *logStreamHeap) Pop() interface{} {
+	old := h.streams
+	s := old[len(old)-1]
+	h.streams = old[:len(old)-1]
+	return s
+}
+
+// mergeLogStreams shows the selected commits of every stream as a single
+// history, newest first by the date chosen by --date-field, which each
+// stream must be ordered by too. Only one commit per repository is held at a
+// time, so histories are never loaded whole. A repository whose history
+// can't be read is reported and left out from then on.
+func mergeLogStreams(streams []*logStream, dateField string, selection *commitSelection, limit *logLimit, show func(pathSpec string, sc *selectedCommit) error) {
+	h := &logStreamHeap{dateField: dateField}
+	for _, s := range streams {
+		if s.readAhead(selection) {
+			h.streams = append(h.streams, s)
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 && !limit.done() {
+		s := h.streams[0]
+		if limit.take() {
+			if err := show(s.pathSpec, s.next); brokenPipe(err) {
+				return
+			} else if err != nil {
+				fmt.Printf("Error processing commits for repository at %s: %v\n", parseRevisionSpec(s.pathSpec).Path, err)
+				heap.Pop(h)
+				continue
+			}
+		}
+
+		if s.readAhead(selection) {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+}
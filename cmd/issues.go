@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var issueRegex string
+
+// defaultIssueRegex matches tracker keys such as PLAT-1234
+const defaultIssueRegex = `\b[A-Z][A-Z0-9]+-[0-9]+\b`
+
+// defaultBranchNames are the branches taken as a repository's main line, along
+// with whatever its remote's HEAD points at
+var defaultBranchNames = []string{"main", "master"}
+
+// issueKeys returns the distinct issue keys referenced by a commit message.
+// When the message names none, keys in the branch name are used instead; pass
+// an empty branch for commits that didn't start on that branch.
+func issueKeys(re *regexp.Regexp, message, branch string) []string {
+	keys := uniqueMatches(re, message)
+	if len(keys) == 0 {
+		keys = uniqueMatches(re, branch)
+	}
+	return keys
+}
+
+// uniqueMatches returns the distinct matches of re in s, in order of appearance
+func uniqueMatches(re *regexp.Regexp, s string) []string {
+	var matches []string
+	seen := make(map[string]bool)
+	for _, m := range re.FindAllString(s, -1) {
+		if !seen[m] {
+			seen[m] = true
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// mainLineCommits returns the commits reachable from the repository's default
+// branch, locally or on the remote, other than the counted branch itself.
+// Those commits were made on the main line, so the name of a feature branch
+// that was later started from it says nothing about them.
+func mainLineCommits(repo *git.Repository, remote string, counted plumbing.ReferenceName) (map[plumbing.Hash]bool, error) {
+	if remote == "" {
+		remote = git.DefaultRemoteName
+	}
+	names := []plumbing.ReferenceName{plumbing.NewRemoteHEADReferenceName(remote)}
+	for _, name := range defaultBranchNames {
+		names = append(names, plumbing.NewBranchReferenceName(name), plumbing.NewRemoteReferenceName(remote, name))
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	for _, name := range names {
+		ref, err := repo.Reference(name, true)
+		if err != nil || ref.Name() == counted {
+			continue
+		}
+		tip, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			continue
+		}
+		// Commits seen from an earlier tip, and their parents, are skipped
+		err = object.NewCommitPreorderIter(tip, seen, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return seen, nil
+}
+
+// commitSummary formats a commit as its short hash and subject line
+func commitSummary(c *object.Commit) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return c.Hash.String()[:7] + " " + subject
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueKeys(t *testing.T) {
+	re := regexp.MustCompile(defaultIssueRegex)
+
+	tests := []struct {
+		name    string
+		message string
+		branch  string
+		want    []string
+	}{
+		{name: "Key in message", message: "PLAT-1234: fix the cache", want: []string{"PLAT-1234"}},
+		{name: "Several keys", message: "PLAT-1 and OPS-22, see PLAT-1", want: []string{"PLAT-1", "OPS-22"}},
+		{name: "Message wins over branch", message: "PLAT-1 fix", branch: "feature/OPS-2-thing", want: []string{"PLAT-1"}},
+		{name: "Key in branch", message: "fix the cache", branch: "feature/OPS-2-thing", want: []string{"OPS-2"}},
+		{name: "No key", message: "fix the cache", branch: "main", want: nil},
+		{name: "Lowercase is not a key", message: "plat-1234 fix", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, issueKeys(re, tt.message, tt.branch))
+		})
+	}
+}
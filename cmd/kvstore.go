@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// kvStore is a minimal key-value store with values grouped into buckets
+type kvStore interface {
+	// Get returns the value stored under key, or nil if there is none
+	Get(bucket, key string) ([]byte, error)
+	// Put stores value under key, replacing any previous value
+	Put(bucket, key string, value []byte) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(bucket, key string) error
+	// Keys returns every key in a bucket
+	Keys(bucket string) ([]string, error)
+	// Used returns when key was last read or written, or the zero time if
+	// it is missing
+	Used(bucket, key string) (time.Time, error)
+}
+
+// validKeyRe matches bucket names and keys that are safe to use as file names
+var validKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tempSuffix marks files that are still being written
+const tempSuffix = ".tmp"
+
+// dirStore is an embedded kvStore that keeps each value in its own file under
+// root/bucket/key. Reads and writes only touch the key involved, and each
+// write is atomic, so the store scales to many thousands of keys. A file's
+// modification time is when its key was last used.
+type dirStore struct {
+	root string
+}
+
+// newDirStore opens a dirStore rooted at dir, creating it if needed
+func newDirStore(dir string) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirStore{root: dir}, nil
+}
+
+// path returns the file a key is stored in
+func (s *dirStore) path(bucket, key string) (string, error) {
+	if !validKeyRe.MatchString(bucket) {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	if !validKeyRe.MatchString(key) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, bucket, key), nil
+}
+
+func (s *dirStore) Get(bucket, key string) ([]byte, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Failing to record the read only makes the key look older to prune
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, nil
+}
+
+func (s *dirStore) Put(bucket, key string, value []byte) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, value)
+}
+
+func (s *dirStore) Delete(bucket, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *dirStore) Keys(bucket string) ([]string, error) {
+	if !validKeyRe.MatchString(bucket) {
+		return nil, fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	files, err := os.ReadDir(filepath.Join(s.root, bucket))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || strings.Contains(file.Name(), tempSuffix) {
+			continue
+		}
+		keys = append(keys, file.Name())
+	}
+	return keys, nil
+}
+
+func (s *dirStore) Used(bucket, key string) (time.Time, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// writeFileAtomic writes data to a temporary file that is then renamed into
+// place, so readers never see a partial write
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+tempSuffix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
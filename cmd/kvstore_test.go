@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newDirStore(filepath.Join(dir, "store"))
+	assert.NoError(t, err)
+
+	// Missing keys and buckets are empty, not errors
+	value, err := store.Get("entries", "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+	keys, err := store.Keys("entries")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.Put("entries", fmt.Sprintf("key-%d", i), []byte(fmt.Sprint(i))))
+	}
+	assert.NoError(t, store.Put("entries", "key-1", []byte("replaced")))
+
+	// Reading a key marks it as used
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "store", "entries", "key-1"), old, old))
+	used, err := store.Used("entries", "key-1")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, old, used, time.Second)
+
+	value, err = store.Get("entries", "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), value)
+	used, err = store.Used("entries", "key-1")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), used, time.Minute)
+	used, err = store.Used("entries", "missing")
+	assert.NoError(t, err)
+	assert.True(t, used.IsZero())
+
+	assert.NoError(t, store.Delete("entries", "key-0"))
+	assert.NoError(t, store.Delete("entries", "key-0"))
+
+	// Leftover temporary files are not keys
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "store", "entries", "key-9"+tempSuffix+"123"), nil, 0644))
+
+	keys, err = store.Keys("entries")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"key-1", "key-2"}, keys)
+
+	// Keys cannot escape the store
+	assert.Error(t, store.Put("entries", "../escape", nil))
+	assert.Error(t, store.Put("../escape", "key", nil))
+}
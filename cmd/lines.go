@@ -2,8 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -17,203 +18,373 @@ var (
 	remoteName     string
 	filenamesRegex string
 	weekToDate     bool
+	dateField      string
 	noCache        bool
 	timeNow        = time.Now // For testing
 	linesCmd       = &cobra.Command{
-		Use:   "lines [paths...]",
+		Use:   "lines [paths...] [-- pathspec...]",
 		Short: "Count lines added/removed by authors matching regex",
-		Run:   runLines,
+		Long: `Count lines added/removed by authors matching regex in the repositories at
+paths, each optionally followed by @branch. Pathspecs after "--" restrict the
+count to files at, under or matching (as a glob) the given paths, relative to
+the repository root.`,
+		Run: runLines,
 	}
 )
 
 func init() {
 	countCmd.AddCommand(linesCmd)
-	linesCmd.Flags().StringVarP(&authorRegex, "author-regex", "a", "", "Regex pattern to match author name or email")
+	addFilterFlags(linesCmd)
 	linesCmd.Flags().StringVarP(&remoteName, "remote", "r", "", "Remote name to use for branch references")
 	linesCmd.Flags().StringVarP(&filenamesRegex, "filenames-regex", "f", "", "Regex pattern to match filenames (e.g., '(py$|yml$)' for Python and YAML files)")
 	linesCmd.Flags().BoolVarP(&weekToDate, "week-to-date", "w", false, "Count lines from start of current week (Monday) instead of current day")
+	linesCmd.Flags().StringVar(&dateField, "date-field", "author", "Commit date to filter on: author (written) or committer (landed)")
+	linesCmd.Flags().StringVar(&groupBy, "by", "", "Break the totals down per group: author, type or scope (Conventional Commits), or issue")
+	linesCmd.Flags().StringVar(&issueRegex, "issue-regex", defaultIssueRegex, "Regex pattern matching issue keys in commit messages and branch names, used by --by issue (lines of commits with several keys are split between them)")
+	linesCmd.Flags().StringVar(&followFile, "follow", "", "Count the changes to this one file over its whole history, following it across renames")
 	linesCmd.Flags().BoolVarP(&noCache, "no-cache", "n", false, "Disable caching of results")
+	linesCmd.Flags().BoolVar(&noDaemon, "no-daemon", false, "Compute the result here even if grit daemon is running")
+	linesCmd.Flags().DurationVar(&maxLatency, "max-latency", 0, "If a cached result is stale and a fresh one takes longer than this (e.g. 50ms), print the stale result marked with '*' and refresh it in the background")
 }
 
 func runLines(cmd *cobra.Command, args []string) {
+	args, pathspecs := splitPathspecs(cmd, args)
 	if len(args) == 0 {
 		args = []string{"./"}
 	}
 
-	var cache *Cache
-	var err error
+	if err := validateDateField(dateField); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if err := validateGroupBy(groupBy); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	cacheArgs := flagArgs()
+	cacheArgs.Pathspecs = pathspecs
+
+	// --max-latency bounds the whole command, including any wait for the
+	// daemon
+	start := time.Now()
+	if !noDaemon {
+		timeout := daemonQueryTimeout
+		if maxLatency > 0 {
+			timeout = min(timeout, maxLatency)
+		}
+		if resp, err := queryDaemon(args, cacheArgs, timeout); err == nil {
+			if resp.Error != "" {
+				fmt.Printf("Error %s\n", resp.Error)
+				return
+			}
+			fmt.Print(resp.Output)
+			printResults(resp.Results, false)
+			return
+		}
+	}
+
+	// rejected is a matching cache entry that could not be used
+	var rejected *CacheEntry
 
 	if !noCache {
-		// Try to load cache
-		cache, err = loadCache()
+		// Try to find matching cache entry
+		entry, err := findMatchingCacheEntry(args, cacheArgs)
 		if err != nil {
 			fmt.Printf("Warning: Could not load cache: %v\n", err)
-			cache = &Cache{Entries: make([]CacheEntry, 0)}
+		} else if entry != nil {
+			entry.Rejected = cacheInvalidReason(entry, args)
+			if entry.Rejected == "" {
+				if err := recordCacheHit(); err != nil {
+					fmt.Printf("Warning: Could not save cache: %v\n", err)
+				}
+				printResults(entry.Results, false)
+				return
+			}
+			rejected = entry
 		}
+	}
 
-		// Try to find matching cache entry
-		entry := findMatchingCacheEntry(cache, args, authorRegex, remoteName, filenamesRegex, weekToDate)
-		if entry != nil && isCacheValid(entry, args) {
-			fmt.Printf("+%d/-%d", entry.Results.Added, entry.Results.Deleted)
+	query, err := newLinesQuery(args, cacheArgs)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if !noCache {
+		if store, err := openCacheStore(); err == nil {
+			query.selection.stats = cachedCommitStats(store)
+		}
+	}
+
+	var entry CacheEntry
+	if rejected != nil && maxLatency > 0 {
+		// Serve the stale result if a fresh one takes too long
+		done := make(chan struct{})
+		go func() {
+			entry = query.count(timeNow())
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(maxLatency - time.Since(start)):
+			refreshInBackground(cacheKey(args, cacheArgs))
+			printResults(rejected.Results, true)
 			return
 		}
+	} else {
+		entry = query.count(timeNow())
 	}
 
-	var filenameRe *regexp.Regexp
-	if filenamesRegex != "" {
-		filenameRe, err = regexp.Compile(filenamesRegex)
+	// Update cache if caching is enabled
+	if !noCache {
+		if rejected != nil {
+			entry.Rejected = rejected.Rejected
+		}
+
+		// Replace any rejected entry for the same arguments
+		err := withCacheLock(func() error {
+			return storeCacheEntry(entry)
+		})
 		if err != nil {
-			fmt.Printf("Error compiling filename regex pattern: %v\n", err)
-			return
+			fmt.Printf("Warning: Could not save cache: %v\n", err)
 		}
+		finishRefresh(cacheKey(args, cacheArgs))
+	}
+
+	printResults(entry.Results, false)
+}
+
+// flagArgs returns the query arguments given on the command line
+func flagArgs() CacheArgs {
+	return CacheArgs{
+		AuthorRegex:      authorRegex,
+		Authors:          authorPatterns,
+		CommitterRegex:   committerRegex,
+		ExcludeAuthors:   excludeAuthors,
+		ExcludeBots:      excludeBots,
+		RemoteName:       remoteName,
+		FilenamesRegex:   filenamesRegex,
+		WeekToDate:       weekToDate,
+		DateField:        dateField,
+		CoauthorCredit:   coauthorCredit,
+		CoauthorTrailers: coauthorTrailers,
+		GroupBy:          groupBy,
+		Grep:             grepPatterns,
+		InvertGrep:       invertGrep,
+		IssueRegex:       issueRegex,
+		Pickaxe:          pickaxeString,
+		PickaxeRegex:     pickaxeRegex,
+		Follow:           followFile,
 	}
+}
+
+// linesQuery counts the lines changed in a set of path specs, with its
+// patterns compiled once up front. Repositories are opened through open and
+// commits diffed through selection.stats, which the daemon replaces with
+// in-memory versions.
+type linesQuery struct {
+	out       io.Writer // where errors reading repositories are reported
+	paths     []string
+	open      func(path string) (*git.Repository, error)
+	args      CacheArgs
+	selection *commitSelection
+	issueRe   *regexp.Regexp
+}
 
-	re, err := regexp.Compile(authorRegex)
+// newLinesQuery compiles the patterns in args
+func newLinesQuery(paths []string, args CacheArgs) (*linesQuery, error) {
+	q := &linesQuery{
+		out:   os.Stdout,
+		paths: paths,
+		args:  args,
+		open:  git.PlainOpen,
+	}
+
+	var err error
+	q.selection, err = newCommitSelection(args)
 	if err != nil {
-		fmt.Printf("Error compiling author regex pattern: %v\n", err)
-		return
+		return nil, err
+	}
+	q.selection.skipMerges = true
+	q.selection.pickaxeCounts = true
+
+	q.issueRe, err = regexp.Compile(args.IssueRegex)
+	if err != nil {
+		return nil, fmt.Errorf("compiling issue regex pattern: %w", err)
+	}
+
+	return q, nil
+}
+
+// count totals the lines added and removed by matching commits in the time
+// window around now, and returns them as a cache entry. Repositories that
+// can't be read are reported and skipped.
+func (q *linesQuery) count(now time.Time) CacheEntry {
+	var startTime, endTime time.Time
+	if q.args.Follow == "" {
+		startTime, endTime = countWindow(now, q.args.WeekToDate)
 	}
+	q.selection.since = startTime
 
 	var totalAdded, totalDeleted int64
+	groups := breakdown{}
+	var untracked []string
 	headHashes := make(map[string]string)
 
-	for _, pathSpec := range args {
+	for _, pathSpec := range q.paths {
 		// Split path and branch if specified (path@branch)
-		path := pathSpec
-		branch := ""
-		if idx := strings.LastIndex(pathSpec, "@"); idx != -1 {
-			path = pathSpec[:idx]
-			branch = pathSpec[idx+1:]
-		}
+		spec := parseRevisionSpec(pathSpec)
+		path, branch := spec.Path, spec.Branch
 
-		repo, err := git.PlainOpen(path)
+		repo, err := q.open(path)
 		if err != nil {
-			fmt.Printf("Error opening repository at %s: %v\n", path, err)
+			fmt.Fprintf(q.out, "Error opening repository at %s: %v\n", path, err)
 			continue
 		}
 
-		var hash plumbing.Hash
-		if branch == "" {
-			// Use HEAD if no branch specified
-			head, err := repo.Head()
-			if err != nil {
-				fmt.Printf("Error getting HEAD for repository at %s: %v\n", path, err)
-				continue
-			}
-			hash = head.Hash()
-			headHashes[path] = hash.String()
-		} else {
-			var refName plumbing.ReferenceName
-			if remoteName != "" {
-				// Check remote branch
-				refName = plumbing.NewRemoteReferenceName(remoteName, branch)
+		ref, err := spec.resolve(repo, q.args.RemoteName)
+		if err != nil {
+			if branch == "" {
+				fmt.Fprintf(q.out, "Error getting HEAD for repository at %s: %v\n", path, err)
 			} else {
-				// Check local branch
-				refName = plumbing.NewBranchReferenceName(branch)
+				fmt.Fprintf(q.out, "Error getting branch %s for repository at %s: %v\n", branch, path, err)
 			}
-			branchRef, err := repo.Reference(refName, true)
-			if err != nil {
-				fmt.Printf("Error getting branch %s for repository at %s: %v\n", branch, path, err)
-				continue
-			}
-			hash = branchRef.Hash()
-			headHashes[path] = hash.String()
+			continue
 		}
+		hash := ref.Hash()
+		headHashes[pathSpec] = hash.String()
 
-		now := timeNow()
-		var startTime time.Time
-		if weekToDate {
-			// Calculate start of current week (Monday)
-			weekday := now.Weekday()
-			var daysToSubtract int
-			if weekday == time.Sunday {
-				daysToSubtract = 7 // Go back 7 days to get to last Monday
-			} else {
-				daysToSubtract = int(weekday) - 1
+		// The branch name is also searched for issue keys, for the commits
+		// made on the branch rather than on the main line it started from
+		branchName := branch
+		if branch == "" && ref.Name().IsBranch() {
+			branchName = ref.Name().Short()
+		}
+		var mainLine map[plumbing.Hash]bool
+		if q.args.GroupBy == "issue" && len(uniqueMatches(q.issueRe, branchName)) > 0 {
+			mainLine, err = mainLineCommits(repo, q.args.RemoteName, ref.Name())
+			if err != nil {
+				fmt.Fprintf(q.out, "Error finding the default branch for repository at %s: %v\n", path, err)
+				continue
 			}
-			startTime = now.AddDate(0, 0, -daysToSubtract)
-			// Set to start of Monday (00:00:00) to include all commits from Monday onwards
-			startTime = time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, now.Location())
-		} else {
-			// Start of current day
-			startTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 		}
 
 		commits, err := repo.Log(&git.LogOptions{From: hash})
 		if err != nil {
-			fmt.Printf("Error getting commits for repository at %s: %v\n", path, err)
+			fmt.Fprintf(q.out, "Error getting commits for repository at %s: %v\n", path, err)
 			continue
 		}
 
+		q.selection.startHistory()
 		err = commits.ForEach(func(c *object.Commit) error {
-			if c.Author.When.Before(startTime) {
-				return nil
-			}
-
-			// If the commit is a merge commit, skip it
-			if len(c.ParentHashes) > 1 {
-				return nil
-			}
-
-			// Match against both name and email
-			if !re.MatchString(c.Author.Name) && !re.MatchString(c.Author.Email) {
-				return nil
-			}
-
-			stats, err := c.Stats()
-			if err != nil {
+			sc, err := q.selection.selectCommit(c)
+			if err != nil || sc == nil {
 				return err
 			}
+			credits := sc.Credits
+			added, deleted := sc.totals()
 
-			for _, stat := range stats {
-				// Filter by filename regex if specified
-				if filenameRe != nil && !filenameRe.MatchString(stat.Name) {
-					continue
+			totalAdded += creditedTotal(credits, added)
+			totalDeleted += creditedTotal(credits, deleted)
+
+			switch q.args.GroupBy {
+			case "author":
+				for _, cr := range credits {
+					groups.add(authorKey(cr.Signature), cr.share(added), cr.share(deleted))
+				}
+			case "type", "scope":
+				cc := parseConventionalCommit(c.Message)
+				key := cc.Type
+				if q.args.GroupBy == "scope" {
+					key = cc.Scope
+					if key == "" {
+						key = "(none)"
+					}
+				}
+				group := groups.add(key, creditedTotal(credits, added), creditedTotal(credits, deleted))
+				if cc.Breaking && q.args.GroupBy == "type" {
+					group.Breaking++
+				}
+			case "issue":
+				commitBranch := branchName
+				if mainLine[c.Hash] {
+					commitBranch = ""
+				}
+				keys := issueKeys(q.issueRe, c.Message, commitBranch)
+				if len(keys) == 0 {
+					keys = []string{"(none)"}
+					untracked = append(untracked, commitSummary(c))
+				}
+				// Work on several tickets is split evenly between them, so the
+				// tickets add up to the total
+				added, deleted := creditedTotal(credits, added), creditedTotal(credits, deleted)
+				for i, key := range keys {
+					groups.add(key, evenShare(added, i, len(keys)), evenShare(deleted, i, len(keys)))
 				}
-				totalAdded += int64(stat.Addition)
-				totalDeleted += int64(stat.Deletion)
 			}
 			return nil
 		})
 
 		if err != nil {
-			fmt.Printf("Error processing commits for repository at %s: %v\n", path, err)
+			fmt.Fprintf(q.out, "Error processing commits for repository at %s: %v\n", path, err)
 			continue
 		}
 	}
 
-	// Create new cache entry and update cache if caching is enabled
-	if !noCache {
-		newEntry := CacheEntry{
-			Args: struct {
-				AuthorRegex    string
-				RemoteName     string
-				FilenamesRegex string
-				WeekToDate     bool
-			}{
-				AuthorRegex:    authorRegex,
-				RemoteName:     remoteName,
-				FilenamesRegex: filenamesRegex,
-				WeekToDate:     weekToDate,
-			},
-			Paths:      args,
-			HeadHashes: headHashes,
-			Results: struct {
-				Added   int64
-				Deleted int64
-			}{
-				Added:   totalAdded,
-				Deleted: totalDeleted,
-			},
-			Timestamp: time.Now(),
-		}
+	return CacheEntry{
+		Args:       q.args,
+		Paths:      q.paths,
+		HeadHashes: headHashes,
+		Results: CacheResults{
+			Added:     totalAdded,
+			Deleted:   totalDeleted,
+			Groups:    groups.sorted(),
+			Untracked: untracked,
+		},
+		Timestamp:   now,
+		WindowStart: startTime,
+		WindowEnd:   endTime,
+	}
+}
 
-		// Update cache
-		cache.Entries = append(cache.Entries, newEntry)
-		if err := saveCache(cache); err != nil {
-			fmt.Printf("Warning: Could not save cache: %v\n", err)
-		}
+// countWindow returns the time window that commits are counted in: the
+// current day, or the current week starting on Monday. The end is exclusive.
+func countWindow(now time.Time, weekToDate bool) (time.Time, time.Time) {
+	// Start of current day
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !weekToDate {
+		return start, start.AddDate(0, 0, 1)
 	}
 
-	fmt.Printf("+%d/-%d", totalAdded, totalDeleted)
+	// Calculate start of current week (Monday)
+	weekday := now.Weekday()
+	var daysToSubtract int
+	if weekday == time.Sunday {
+		daysToSubtract = 6 // Go back 6 days to get to last Monday
+	} else {
+		daysToSubtract = int(weekday) - 1
+	}
+	start = start.AddDate(0, 0, -daysToSubtract)
+	return start, start.AddDate(0, 0, 7)
+}
+
+// validateDateField checks that field names a commit date grit knows about
+func validateDateField(field string) error {
+	switch field {
+	case "author", "committer":
+		return nil
+	}
+	return fmt.Errorf("invalid date field %q (must be author or committer)", field)
+}
+
+// commitDate returns the author or committer date of a commit. The author
+// date records when the change was written; the committer date records when
+// it landed, which differs after a rebase or cherry-pick.
+func commitDate(c *object.Commit, field string) time.Time {
+	if field == "committer" {
+		return c.Committer.When
+	}
+	return c.Author.When
 }
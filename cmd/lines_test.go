@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -318,7 +319,7 @@ func TestRunLines(t *testing.T) {
 			io.Copy(&buf, r)
 
 			if tt.wantErr {
-				assert.Contains(t, buf.String(), "Error compiling filename regex")
+				assert.Contains(t, buf.String(), "Error: compiling filename regex")
 			} else {
 				// Check output format
 				expected := fmt.Sprintf("+%d/-%d", tt.wantAdded, tt.wantDeleted)
@@ -396,3 +397,638 @@ func setupTestRepoWithDifferentDays(t *testing.T) (string, func()) {
 		os.RemoveAll(dir)
 	}
 }
+
+func TestRunLinesDateField(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return referenceTime
+	}
+	defer func() {
+		timeNow = time.Now
+		dateField = "author"
+		noCache = false
+	}()
+
+	dir, err := ioutil.TempDir("", "grit-test-date-field")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte("one\ntwo\n"), 0644)
+	assert.NoError(t, err)
+	_, err = worktree.Add("test.txt")
+	assert.NoError(t, err)
+
+	// Written last week, but rebased onto the branch today
+	_, err = worktree.Commit("Rebased commit", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "Rebaser",
+			Email: "rebaser@example.com",
+			When:  referenceTime.Add(-7 * 24 * time.Hour),
+		},
+		Committer: &object.Signature{
+			Name:  "Rebaser",
+			Email: "rebaser@example.com",
+			When:  referenceTime.Add(-time.Hour),
+		},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		dateField string
+		want      string
+	}{
+		{name: "author date excludes rebased work", dateField: "author", want: "+0/-0"},
+		{name: "committer date includes rebased work", dateField: "committer", want: "+2/-0"},
+		{name: "invalid date field", dateField: "bogus", want: "Error: invalid date field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			authorRegex = ""
+			remoteName = ""
+			filenamesRegex = ""
+			weekToDate = false
+			noCache = true
+			dateField = tt.dateField
+
+			runLines(nil, []string{dir})
+
+			w.Close()
+			os.Stdout = old
+
+			var buf bytes.Buffer
+			io.Copy(&buf, r)
+			assert.Contains(t, buf.String(), tt.want)
+		})
+	}
+}
+
+func TestRunLinesCoauthorCredit(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return referenceTime
+	}
+	defer func() {
+		timeNow = time.Now
+		authorRegex = ""
+		coauthorCredit = "full"
+		groupBy = ""
+		noCache = false
+	}()
+
+	dir, err := ioutil.TempDir("", "grit-test-coauthors")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte("1\n2\n3\n4\n5\n6\n"), 0644)
+	assert.NoError(t, err)
+	_, err = worktree.Add("test.txt")
+	assert.NoError(t, err)
+
+	_, err = worktree.Commit("Mob on the parser\n\nCo-authored-by: Mirabel Smith <mirabel@example.com>\nCo-authored-by: Louisa <louisa@example.com>\n", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "Nathanael Farley",
+			Email: "nathanael@example.com",
+			When:  referenceTime.Add(-time.Hour),
+		},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		authorRegex string
+		credit      string
+		groupBy     string
+		want        string
+	}{
+		{name: "Full credit matches co-author", authorRegex: "Mirabel", credit: "full", want: "+6/-0"},
+		{name: "Split credit gives a share", authorRegex: "Mirabel", credit: "split", want: "+2/-0"},
+		{name: "No credit ignores co-authors", authorRegex: "Mirabel", credit: "none", want: "+0/-0"},
+		{name: "Full credit counts the diff once", authorRegex: "Mirabel|Louisa", credit: "full", want: "+6/-0"},
+		{
+			name:    "Full credit breakdown",
+			credit:  "full",
+			groupBy: "author",
+			want: "+6/-0\n" +
+				"Louisa <louisa@example.com>               +6/-0  1 commit(s)\n" +
+				"Mirabel Smith <mirabel@example.com>       +6/-0  1 commit(s)\n" +
+				"Nathanael Farley <nathanael@example.com>  +6/-0  1 commit(s)\n",
+		},
+		{
+			name:    "Split credit breakdown",
+			credit:  "split",
+			groupBy: "author",
+			want: "+6/-0\n" +
+				"Louisa <louisa@example.com>               +2/-0  1 commit(s)\n" +
+				"Mirabel Smith <mirabel@example.com>       +2/-0  1 commit(s)\n" +
+				"Nathanael Farley <nathanael@example.com>  +2/-0  1 commit(s)\n",
+		},
+		{name: "Invalid credit", credit: "half", want: "Error: invalid co-author credit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			authorRegex = tt.authorRegex
+			remoteName = ""
+			filenamesRegex = ""
+			weekToDate = false
+			noCache = true
+			coauthorCredit = tt.credit
+			groupBy = tt.groupBy
+
+			runLines(nil, []string{dir})
+
+			w.Close()
+			os.Stdout = old
+
+			var buf bytes.Buffer
+			io.Copy(&buf, r)
+			if tt.groupBy != "" {
+				assert.Equal(t, tt.want, buf.String())
+			} else {
+				assert.Contains(t, buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunLinesByType(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return referenceTime
+	}
+	defer func() {
+		timeNow = time.Now
+		groupBy = ""
+		grepPatterns = nil
+		invertGrep = false
+		noCache = false
+	}()
+
+	dir, err := ioutil.TempDir("", "grit-test-by-type")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	commits := []struct {
+		message string
+		content string
+	}{
+		{"feat(parser): first feature", "1\n2\n3\n"},
+		{"fix(parser): off by one", "1\n2\n4\n"},
+		{"feat!: second feature", "1\n2\n4\n5\n6\n"},
+		{"Tidy up", "1\n2\n4\n5\n6\n7\n"},
+	}
+	for i, c := range commits {
+		err = ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte(c.content), 0644)
+		assert.NoError(t, err)
+		_, err = worktree.Add("test.txt")
+		assert.NoError(t, err)
+		_, err = worktree.Commit(c.message, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "Nathanael Farley",
+				Email: "nathanael@example.com",
+				When:  referenceTime.Add(time.Duration(i-10) * time.Minute),
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name    string
+		groupBy string
+		grep    []string
+		invert  bool
+		want    string
+	}{
+		{
+			name:    "By type",
+			groupBy: "type",
+			want:    "+7/-1\nfeat   +5/-0  2 commit(s), 1 breaking\nfix    +1/-1  1 commit(s)\nother  +1/-0  1 commit(s)\n",
+		},
+		{
+			name:    "By scope",
+			groupBy: "scope",
+			want:    "+7/-1\nparser  +4/-1  2 commit(s)\n(none)  +3/-0  2 commit(s)\n",
+		},
+		{name: "Grep", grep: []string{"^fix"}, want: "+1/-1"},
+		{name: "Invert grep", grep: []string{"^fix"}, invert: true, want: "+6/-0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			authorRegex = ""
+			remoteName = ""
+			filenamesRegex = ""
+			weekToDate = false
+			noCache = true
+			groupBy = tt.groupBy
+			grepPatterns = tt.grep
+			invertGrep = tt.invert
+
+			runLines(nil, []string{dir})
+
+			w.Close()
+			os.Stdout = old
+
+			var buf bytes.Buffer
+			io.Copy(&buf, r)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestRunLinesByIssue(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return referenceTime
+	}
+	defer func() {
+		timeNow = time.Now
+		groupBy = ""
+		noCache = false
+	}()
+
+	// commitAll writes each file in turn and commits it with the given message
+	commitAll := func(dir, branch string, commits [][2]string) {
+		repo, err := git.PlainInit(dir, false)
+		assert.NoError(t, err)
+		worktree, err := repo.Worktree()
+		assert.NoError(t, err)
+		for i, c := range commits {
+			if i == 1 && branch != "" {
+				err = worktree.Checkout(&git.CheckoutOptions{
+					Create: true,
+					Branch: plumbing.NewBranchReferenceName(branch),
+				})
+				assert.NoError(t, err)
+			}
+			err = ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte(c[1]), 0644)
+			assert.NoError(t, err)
+			_, err = worktree.Add("test.txt")
+			assert.NoError(t, err)
+			_, err = worktree.Commit(c[0], &git.CommitOptions{
+				Author: &object.Signature{
+					Name:  "Nathanael Farley",
+					Email: "nathanael@example.com",
+					When:  referenceTime.Add(time.Duration(i-10) * time.Minute),
+				},
+			})
+			assert.NoError(t, err)
+		}
+	}
+
+	dir1, err := ioutil.TempDir("", "grit-test-by-issue")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir1)
+	commitAll(dir1, "", [][2]string{
+		{"PLAT-1: first part", "1\n2\n3\n"},
+		{"Tidy up", "1\n2\n3\n4\n"},
+		{"PLAT-1, PLAT-2: shared part", "1\n2\n3\n4\n5\n6\n7\n"},
+	})
+
+	dir2, err := ioutil.TempDir("", "grit-test-by-issue")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir2)
+	commitAll(dir2, "OPS-7-cleanup", [][2]string{
+		{"PLAT-1 second part", "1\n2\n"},
+		{"Clean up", "1\n"},
+	})
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = true
+	groupBy = "issue"
+
+	runLines(nil, []string{dir1, dir2})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	// The commit naming two tickets has its lines split between them, so the
+	// tickets add up to the total
+	assert.True(t, strings.HasPrefix(output, "+9/-1\nPLAT-1  +6/-0  3 commit(s)\n"), output)
+	assert.Contains(t, output, "PLAT-2  +2/-0  1 commit(s)\n")
+	assert.Contains(t, output, "OPS-7   +0/-1  1 commit(s)\n")
+	assert.Contains(t, output, "(none)  +1/-0  1 commit(s)\n")
+	assert.Contains(t, output, "Commits without an issue key:\n")
+	assert.Contains(t, output, " Tidy up\n")
+	assert.NotContains(t, output, " Clean up\n")
+}
+
+func TestRunLinesByIssueBranchOnly(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() {
+		timeNow = time.Now
+		groupBy = ""
+		noCache = false
+	}()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	commitFiles(t, dir, worktree, map[string]string{"a.txt": "1\n"}, "PLAT-1: base", referenceTime.Add(-3*time.Hour))
+	commitFiles(t, dir, worktree, map[string]string{"b.txt": "1\n2\n"}, "Teammate tweak", referenceTime.Add(-2*time.Hour))
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{
+		Create: true,
+		Branch: plumbing.NewBranchReferenceName("PLAT-42-feature"),
+	}))
+	commitFiles(t, dir, worktree, map[string]string{"c.txt": "1\n2\n3\n"}, "Add feature", referenceTime.Add(-time.Hour))
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = true
+	groupBy = "issue"
+
+	// Only the commit made on the branch takes the branch's key; the
+	// teammate's commit on master is still untracked work
+	output := captureStdout(func() { runLines(nil, []string{dir}) })
+	assert.Contains(t, output, "PLAT-42  +3/-0  1 commit(s)\n")
+	assert.Contains(t, output, "(none)   +2/-0  1 commit(s)\n")
+	assert.Contains(t, output, "Commits without an issue key:\n")
+	assert.Contains(t, output, " Teammate tweak\n")
+	assert.NotContains(t, output, " Add feature\n")
+
+	// A branch that hasn't diverged yet has no commits of its own
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("master")}))
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{
+		Create: true,
+		Branch: plumbing.NewBranchReferenceName("PLAT-43-next"),
+	}))
+	output = captureStdout(func() { runLines(nil, []string{dir}) })
+	assert.NotContains(t, output, "PLAT-43")
+}
+
+func TestCountWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		now        time.Time
+		weekToDate bool
+		wantStart  time.Time
+		wantEnd    time.Time
+	}{
+		{
+			name:      "Day",
+			now:       time.Date(2024, 1, 3, 15, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Week from Wednesday",
+			now:        time.Date(2024, 1, 3, 15, 0, 0, 0, time.UTC),
+			weekToDate: true,
+			wantStart:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Week from Monday",
+			now:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			weekToDate: true,
+			wantStart:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Week from Sunday starts on the previous Monday",
+			now:        time.Date(2024, 1, 7, 23, 59, 0, 0, time.UTC),
+			weekToDate: true,
+			wantStart:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := countWindow(tt.now, tt.weekToDate)
+			assert.Equal(t, tt.wantStart, start)
+			assert.Equal(t, tt.wantEnd, end)
+		})
+	}
+}
+
+func TestRunLinesPathspec(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() {
+		timeNow = time.Now
+		noCache = false
+	}()
+	noCache = true
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	commitFiles(t, dir, worktree, map[string]string{"docs/guide.md": "guide\n", "src/main.go": "package main\n\nfunc main() {}\n"}, "Add code and docs", referenceTime.Add(-time.Hour))
+
+	for args, want := range map[string]string{
+		"":         "+4/-0",
+		"src":      "+3/-0",
+		"docs/":    "+1/-0",
+		"*/*.go":   "+3/-0",
+		"missing":  "+0/-0",
+		"./docs/.": "+1/-0",
+	} {
+		cmdArgs := []string{"count", "lines", dir}
+		if args != "" {
+			cmdArgs = append(cmdArgs, "--", args)
+		}
+		rootCmd.SetArgs(cmdArgs)
+		output := captureStdout(func() { assert.NoError(t, rootCmd.Execute()) })
+		assert.Equal(t, want, output, "pathspec %q", args)
+	}
+}
+
+// setupPickaxeRepo creates a repository where Alice adds two calls to
+// oldAPI, Bob removes one and Carol only changes the line the other is on
+func setupPickaxeRepo(t *testing.T, when time.Time) string {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	for i, change := range []struct{ author, content string }{
+		{"Alice", "oldAPI()\nnewAPI()\nx := oldAPI()\n"},
+		{"Bob", "newAPI()\nx := oldAPI()\ny := 1\n"},
+		{"Carol", "newAPI()\nz := oldAPI()\ny := 1\n"},
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "api.go"), []byte(change.content), 0644))
+		_, err = worktree.Add("api.go")
+		assert.NoError(t, err)
+		_, err = worktree.Commit("Change by "+change.author, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  change.author,
+				Email: strings.ToLower(change.author) + "@example.com",
+				When:  when.Add(time.Duration(i) * time.Hour),
+			},
+		})
+		assert.NoError(t, err)
+	}
+	return dir
+}
+
+func TestRunLinesPickaxe(t *testing.T) {
+	referenceTime := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() {
+		timeNow = time.Now
+		noCache = false
+		noDaemon = false
+		groupBy = ""
+		pickaxeString = ""
+		pickaxeRegex = ""
+	}()
+	noCache = true
+	noDaemon = true
+	groupBy = "author"
+	dir := setupPickaxeRepo(t, referenceTime.Add(-3*time.Hour))
+
+	// Only the lines containing the string are counted, and moving an
+	// occurrence doesn't count as adding or removing it
+	pickaxeString = "oldAPI"
+	output := captureStdout(func() { runLines(nil, []string{dir}) })
+	assert.Equal(t, "+2/-1\n"+
+		"Alice <alice@example.com>  +2/-0  1 commit(s)\n"+
+		"Bob <bob@example.com>      +0/-1  1 commit(s)\n", output)
+
+	// A regex picks out every commit adding or removing a matching line
+	pickaxeString = ""
+	pickaxeRegex = `old\w+\(`
+	output = captureStdout(func() { runLines(nil, []string{dir}) })
+	assert.Contains(t, output, "+3/-2\n")
+	assert.Contains(t, output, "Carol <carol@example.com>  +1/-1  1 commit(s)\n")
+
+	pickaxeString = "oldAPI"
+	assert.Equal(t, "Error: -S and -G can't be combined\n", captureStdout(func() { runLines(nil, []string{dir}) }))
+}
+
+// setupRenameRepo creates a repository where Alice creates old.go, Bob
+// renames it to new.go changing one line, Carol changes another file and
+// Alice adds to new.go, a day apart from the given time on
+func setupRenameRepo(t *testing.T, when time.Time) string {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	content := func() []byte { return []byte(strings.Join(lines, "\n") + "\n") }
+
+	commit := func(author, message string, day int) {
+		_, err := worktree.Commit(message, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  author,
+				Email: strings.ToLower(author) + "@example.com",
+				When:  when.AddDate(0, 0, day),
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "old.go"), content(), 0644))
+	_, err = worktree.Add("old.go")
+	assert.NoError(t, err)
+	commit("Alice", "Create old.go", 0)
+
+	lines[0] = "renamed"
+	_, err = worktree.Remove("old.go")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.go"), content(), 0644))
+	_, err = worktree.Add("new.go")
+	assert.NoError(t, err)
+	commit("Bob", "Rename old.go to new.go", 1)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "other.go"), []byte("other\n"), 0644))
+	_, err = worktree.Add("other.go")
+	assert.NoError(t, err)
+	commit("Carol", "Add other.go", 2)
+
+	lines = append(lines, "line 10", "line 11")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.go"), content(), 0644))
+	_, err = worktree.Add("new.go")
+	assert.NoError(t, err)
+	commit("Alice", "Extend new.go", 3)
+
+	return dir
+}
+
+func TestRunLinesFollow(t *testing.T) {
+	referenceTime := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() {
+		timeNow = time.Now
+		noCache = false
+		noDaemon = false
+		groupBy = ""
+		followFile = ""
+	}()
+	noCache = true
+	noDaemon = true
+	groupBy = "author"
+
+	// The file's whole lifetime is counted, long before the current day
+	dir := setupRenameRepo(t, referenceTime.AddDate(0, -1, 0))
+	followFile = "new.go"
+	output := captureStdout(func() { runLines(nil, []string{dir}) })
+	assert.Equal(t, "+13/-1\n"+
+		"Alice <alice@example.com>  +12/-0  2 commit(s)\n"+
+		"Bob <bob@example.com>      +1/-1   1 commit(s)\n", output)
+
+	// Results for a followed file stay valid from one day to the next
+	entry := CacheEntry{Args: CacheArgs{Follow: "new.go"}, Timestamp: referenceTime}
+	assert.NotEqual(t, reasonWindow, cacheInvalidReason(&entry, nil))
+	entry.Args.Follow = ""
+	assert.Equal(t, reasonWindow, cacheInvalidReason(&entry, nil))
+
+	assert.Equal(t, "Error: --follow can't be combined with pathspecs\n", captureStdout(func() {
+		rootCmd.SetArgs([]string{"count", "lines", "--no-cache", "--follow", "new.go", dir, "--", "src"})
+		assert.NoError(t, rootCmd.Execute())
+	}))
+}
@@ -2,75 +2,246 @@ package cmd
 
 import (
 	"fmt"
-	"time"
+	"os"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/spf13/cobra"
 )
 
-var logCmd = &cobra.Command{
-	Use:   "log [paths...]",
-	Short: "Show commit log in git log style",
-	Run:   runLog,
-}
+var (
+	today      bool
+	noMerges   bool
+	showStat   bool
+	showPatch  bool
+	interleave bool
+	showGraph  bool
+	decorate   bool
+	maxCount   int
+	skip       int
+	logCmd     = &cobra.Command{
+		Use:   "log [paths...] [-- pathspec...]",
+		Short: "Show commit log in git log style",
+		Long: `Show the commit log of the repositories at paths, each optionally followed by
+@branch. Pathspecs after "--" restrict the log to commits touching files at,
+under or matching (as a glob) the given paths, relative to the repository root.
+
+With the same filters, --no-merges lists exactly the commits that count lines
+counts.
+
+--template is executed once per commit, followed by a newline. Commits have
+the fields Repository, Hash, ShortHash, Parents, Author, AuthorEmail,
+AuthorDate, Committer, CommitterEmail, CommitterDate, Date (as chosen by
+--date-field), Subject, Body, Message, Added, Deleted and Files (each with
+Name, Added and Deleted), and the functions join, json and indent are
+available. --format jsonl writes the same fields as JSON. With --decorate or
+--graph, Refs lists the branches and tags pointing at each commit.
+
+--graph draws the branch and merge topology beside the commits, like git log
+--graph, listing them as git log --topo-order does: never a commit before its
+children, whatever their dates. Commits that aren't shown, because of filters
+or --skip, are drawn through, so the lines lead straight on to their shown
+ancestors.`,
+		Run: runLog,
+	}
+)
 
 func init() {
 	rootCmd.AddCommand(logCmd)
+	addFilterFlags(logCmd)
+	logCmd.Flags().StringVar(&dateField, "date-field", "author", "Commit date to show and filter on: author (written) or committer (landed)")
+	logCmd.Flags().StringVarP(&remoteName, "remote", "r", "", "Remote name to use for branch references")
+	logCmd.Flags().StringVarP(&filenamesRegex, "filenames-regex", "f", "", "Only show commits touching files matching this regex, and count only those files")
+	logCmd.Flags().BoolVar(&today, "today", false, "Only show commits from the current day")
+	logCmd.Flags().BoolVarP(&weekToDate, "week-to-date", "w", false, "Only show commits from the start of the current week (Monday)")
+	logCmd.Flags().BoolVar(&noMerges, "no-merges", false, "Do not show merge commits")
+	logCmd.Flags().IntVarP(&maxCount, "max-count", "n", -1, "Show at most this many commits per repository (in total with --interleave)")
+	logCmd.Flags().StringVar(&logFormat, "format", "medium", "Output format: oneline, medium, full or jsonl (one JSON object per commit)")
+	logCmd.Flags().StringVar(&logTemplate, "template", "", "Go text/template to print each commit with, e.g. '{{.ShortHash}} {{.Author}} +{{.Added}}/-{{.Deleted}}'")
+	logCmd.Flags().BoolVar(&showStat, "stat", false, "List the lines added and removed in each file, with a histogram")
+	logCmd.Flags().BoolVarP(&showPatch, "patch", "p", false, "Show the diff of each commit against its first parent")
+	logCmd.Flags().BoolVar(&interleave, "interleave", false, "Merge the histories of all repositories into one timeline, ordered by the --date-field date and tagged with the repository")
+	logCmd.Flags().StringVar(&followFile, "follow", "", "Show the history of this one file, following it across renames, with the changes to it alone")
+	logCmd.Flags().BoolVar(&showGraph, "graph", false, "Draw the branch and merge topology beside the commits (implies --decorate)")
+	logCmd.Flags().BoolVar(&decorate, "decorate", false, "Show the branches and tags pointing at each commit")
+	logCmd.Flags().IntVar(&skip, "skip", 0, "Skip this many commits per repository (in total with --interleave) before showing any")
 }
 
 func runLog(cmd *cobra.Command, args []string) {
+	args, pathspecs := splitPathspecs(cmd, args)
 	if len(args) == 0 {
 		args = []string{"./"}
 	}
 
-	for _, path := range args {
-		repo, err := git.PlainOpen(path)
-		if err != nil {
-			fmt.Printf("Error opening repository at %s: %v\n", path, err)
-			continue
+	if err := validateDateField(dateField); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	logArgs := flagArgs()
+	logArgs.Pathspecs = pathspecs
+	selection, err := newCommitSelection(logArgs)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	selection.skipMerges = noMerges
+
+	printer, err := newLogPrinter(os.Stdout, logFormat, logTemplate)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	printer.stat = showStat
+	printer.color = printer.human() && colorEnabled()
+	if interleave && followFile != "" {
+		fmt.Println("Error: --follow can't be combined with --interleave")
+		return
+	}
+	if showGraph {
+		if interleave {
+			fmt.Println("Error: --graph can't be combined with --interleave")
+			return
 		}
+		if !printer.human() {
+			fmt.Println("Error: --graph needs the oneline, medium or full format")
+			return
+		}
+		decorate = true
+	}
+	if today || weekToDate {
+		selection.since, _ = countWindow(timeNow(), weekToDate)
+	}
 
-		head, err := repo.Head()
-		if err != nil {
-			fmt.Printf("Error getting HEAD for repository at %s: %v\n", path, err)
-			continue
+	// Refs pointing at commits, by repository path spec
+	refs := make(map[string]map[plumbing.Hash][]string)
+	open := func(pathSpec string, order logOrder) object.CommitIter {
+		repo, commits := openLog(pathSpec, order)
+		if commits != nil && decorate {
+			refs[pathSpec] = refDecorations(repo)
+		}
+		return commits
+	}
+
+	show := func(pathSpec string, sc *selectedCommit) error {
+		entry := newLogEntry(pathSpec, sc, dateField)
+		entry.Refs = refs[pathSpec][sc.Hash]
+		if showPatch {
+			var err error
+			if entry.Patch, err = commitPatch(sc, selection, printer.color); err != nil {
+				return err
+			}
 		}
+		return printer.print(entry)
+	}
 
-		commits, err := repo.Log(&git.LogOptions{From: head.Hash()})
-		if err != nil {
-			fmt.Printf("Error getting commits for repository at %s: %v\n", path, err)
+	if interleave {
+		printer.tag = true
+		var streams []*logStream
+		for _, pathSpec := range args {
+			if commits := open(pathSpec, dateOrder(dateField)); commits != nil {
+				streams = append(streams, &logStream{pathSpec: pathSpec, commits: commits})
+			}
+		}
+		mergeLogStreams(streams, dateField, selection, &logLimit{skip: skip, max: maxCount}, show)
+		return
+	}
+
+	for _, pathSpec := range args {
+		order := logOrder(defaultOrder)
+		if showGraph {
+			// Children are drawn before their parents
+			order = topoOrder
+			printer.graph = &logGraph{}
+		}
+		commits := open(pathSpec, order)
+		if commits == nil {
 			continue
 		}
 
-		if len(args) > 1 {
-			fmt.Printf("\nRepository: %s\n", path)
+		if len(args) > 1 && printer.human() {
+			fmt.Printf("\nRepository: %s\n", pathSpec)
 		}
 
-		err = commits.ForEach(func(c *object.Commit) error {
-			stats, err := c.Stats()
+		limit := &logLimit{skip: skip, max: maxCount}
+		selection.startHistory()
+		err := commits.ForEach(func(c *object.Commit) error {
+			if limit.done() {
+				return storer.ErrStop
+			}
+
+			sc, err := selection.selectCommit(c)
 			if err != nil {
 				return err
 			}
-
-			var added, deleted int
-			for _, stat := range stats {
-				added += stat.Addition
-				deleted += stat.Deletion
+			if sc == nil || !limit.take() {
+				printer.skip(c)
+				return nil
 			}
-
-			fmt.Printf("\ncommit %s\n", c.Hash)
-			fmt.Printf("Author: %s <%s>\n", c.Author.Name, c.Author.Email)
-			fmt.Printf("Date:   %s\n", c.Author.When.Format(time.RFC3339))
-			fmt.Printf("\n    %s\n", c.Message)
-			fmt.Printf("\n    %d file(s) changed, %d insertion(s)(+), %d deletion(s)(-)\n", 
-				len(stats), added, deleted)
-
-			return nil
+			return show(pathSpec, sc)
 		})
 
+		if brokenPipe(err) {
+			// The reader has quit the pager, so nothing more will be seen
+			return
+		}
 		if err != nil {
-			fmt.Printf("Error processing commits for repository at %s: %v\n", path, err)
+			fmt.Printf("Error processing commits for repository at %s: %v\n", parseRevisionSpec(pathSpec).Path, err)
 		}
 	}
 }
+
+// openLog returns the repository of a path spec and the history of the
+// commit it resolves to in the given order, or reports why it can't and
+// returns nil
+func openLog(pathSpec string, order logOrder) (*git.Repository, object.CommitIter) {
+	spec := parseRevisionSpec(pathSpec)
+	path, branch := spec.Path, spec.Branch
+
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		fmt.Printf("Error opening repository at %s: %v\n", path, err)
+		return nil, nil
+	}
+
+	ref, err := spec.resolve(repo, remoteName)
+	if err != nil {
+		if branch == "" {
+			fmt.Printf("Error getting HEAD for repository at %s: %v\n", path, err)
+		} else {
+			fmt.Printf("Error getting branch %s for repository at %s: %v\n", branch, path, err)
+		}
+		return nil, nil
+	}
+
+	commits, err := order(repo, ref.Hash())
+	if err != nil {
+		fmt.Printf("Error getting commits for repository at %s: %v\n", path, err)
+		return nil, nil
+	}
+	return repo, commits
+}
+
+// logLimit applies --skip and --max-count to a stream of selected commits
+type logLimit struct {
+	skip, max      int
+	skipped, shown int
+}
+
+// done reports whether --max-count commits have been shown
+func (l *logLimit) done() bool {
+	return l.max >= 0 && l.shown >= l.max
+}
+
+// take reports whether the next selected commit should be shown, counting it
+// against --skip or --max-count
+func (l *logLimit) take() bool {
+	if l.skipped < l.skip {
+		l.skipped++
+		return false
+	}
+	l.shown++
+	return true
+}
@@ -2,14 +2,19 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 )
@@ -71,3 +76,670 @@ func TestRunLog(t *testing.T) {
 	assert.Contains(t, output, "test@example.com")
 	assert.Contains(t, output, "Test commit")
 }
+
+func TestRunLogAuthorFilter(t *testing.T) {
+	defer func() { authorPatterns = nil }()
+
+	dir, err := ioutil.TempDir("", "grit-log-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	for _, author := range []string{"Nathanael Farley", "dependabot[bot]"} {
+		err = ioutil.WriteFile(filepath.Join(dir, "test.txt"), []byte(author), 0644)
+		assert.NoError(t, err)
+		_, err = worktree.Add("test.txt")
+		assert.NoError(t, err)
+		_, err = worktree.Commit("Commit by "+author, &git.CommitOptions{
+			Author: &object.Signature{Name: author, Email: "test@example.com", When: time.Now()},
+		})
+		assert.NoError(t, err)
+	}
+
+	r, pipeW, _ := os.Pipe()
+	oldStdout := os.Stdout
+	os.Stdout = pipeW
+
+	authorPatterns = []string{"Nathanael"}
+	runLog(nil, []string{dir})
+
+	pipeW.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	assert.Contains(t, output, "Commit by Nathanael Farley")
+	assert.NotContains(t, output, "Commit by dependabot[bot]")
+}
+
+// commitFiles writes files into a worktree and commits them
+func commitFiles(t *testing.T, dir string, worktree *git.Worktree, files map[string]string, message string, when time.Time) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := worktree.Add(name)
+		assert.NoError(t, err)
+	}
+	_, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Test Author", Email: "test@example.com", When: when},
+	})
+	assert.NoError(t, err)
+}
+
+func TestRunLogSelection(t *testing.T) {
+	// Tuesday, January 2, 2024 at 12:00:00 UTC
+	referenceTime := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() { timeNow = time.Now }()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	commitFiles(t, dir, worktree, map[string]string{"docs/guide.md": "guide\n"}, "Add docs", referenceTime.Add(-50*time.Hour))
+	commitFiles(t, dir, worktree, map[string]string{"src/main.go": "package main\n", "src/util.go": "package main\n"}, "Add code", referenceTime.Add(-27*time.Hour))
+	commitFiles(t, dir, worktree, map[string]string{"docs/guide.md": "guide\nmore\n"}, "Tweak docs", referenceTime.Add(-3*time.Hour))
+	commitFiles(t, dir, worktree, map[string]string{"src/main.go": "package main\n\nfunc main() {}\n"}, "Tweak code", referenceTime.Add(-time.Hour))
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"everything", nil, []string{"Tweak code", "Tweak docs", "Add code", "Add docs"}},
+		{"pathspec directory", []string{"--", "src"}, []string{"Tweak code", "Add code"}},
+		{"pathspec glob", []string{"--", "docs/*.md"}, []string{"Tweak docs", "Add docs"}},
+		{"filenames regex", []string{"--filenames-regex", `util\.go$`}, []string{"Add code"}},
+		{"today", []string{"--today"}, []string{"Tweak code", "Tweak docs"}},
+		{"week to date", []string{"--week-to-date"}, []string{"Tweak code", "Tweak docs", "Add code"}},
+		{"max count and skip", []string{"-n", "2", "--skip", "1"}, []string{"Tweak docs", "Add code"}},
+		{"today with max count", []string{"--today", "-n", "1"}, []string{"Tweak code"}},
+	}
+
+	all := []string{"Tweak code", "Tweak docs", "Add code", "Add docs"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				filenamesRegex = ""
+				today = false
+				weekToDate = false
+				maxCount = -1
+				skip = 0
+			}()
+
+			rootCmd.SetArgs(append([]string{"log", dir}, tt.args...))
+			output := captureStdout(func() { assert.NoError(t, rootCmd.Execute()) })
+
+			for _, message := range all {
+				if slices.Contains(tt.want, message) {
+					assert.Contains(t, output, message)
+				} else {
+					assert.NotContains(t, output, message)
+				}
+			}
+		})
+	}
+
+	// Only the selected files are counted
+	rootCmd.SetArgs([]string{"log", dir, "--", "src/main.go"})
+	output := captureStdout(func() { assert.NoError(t, rootCmd.Execute()) })
+	assert.Contains(t, output, "1 file(s) changed, 1 insertion(s)(+), 0 deletion(s)(-)")
+	assert.NotContains(t, output, "2 file(s) changed")
+
+	// Branch and revision specs are resolved as count lines resolves them
+	rootCmd.SetArgs([]string{"log", dir + "@HEAD~2"})
+	output = captureStdout(func() { assert.NoError(t, rootCmd.Execute()) })
+	assert.Contains(t, output, "Add code")
+	assert.NotContains(t, output, "Tweak docs")
+}
+
+func TestRunLogFormats(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\n"), 0644))
+	_, err = worktree.Add("a.txt")
+	assert.NoError(t, err)
+	hash, err := worktree.Commit("Add a\n\nFirst paragraph\nstill first.\n\nSecond paragraph.\n", &git.CommitOptions{
+		Author:    &object.Signature{Name: "Test Author", Email: "test@example.com", When: when},
+		Committer: &object.Signature{Name: "Test Committer", Email: "committer@example.com", When: when},
+	})
+	assert.NoError(t, err)
+	short := hash.String()[:7]
+
+	defer func() {
+		logFormat = "medium"
+		logTemplate = ""
+	}()
+
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		want     string
+	}{
+		{
+			name:   "medium indents every line of the message",
+			format: "medium",
+			want: "\ncommit " + hash.String() + "\n" +
+				"Author: Test Author <test@example.com>\n" +
+				"Date:   2024-01-02T09:00:00Z\n" +
+				"\n" +
+				"    Add a\n" +
+				"\n" +
+				"    First paragraph\n" +
+				"    still first.\n" +
+				"\n" +
+				"    Second paragraph.\n" +
+				"\n" +
+				"    1 file(s) changed, 2 insertion(s)(+), 0 deletion(s)(-)\n",
+		},
+		{
+			name:   "full names the committer",
+			format: "full",
+			want: "\ncommit " + hash.String() + "\n" +
+				"Author: Test Author <test@example.com>\n" +
+				"Commit: Test Committer <committer@example.com>\n" +
+				"\n" +
+				"    Add a\n" +
+				"\n" +
+				"    First paragraph\n" +
+				"    still first.\n" +
+				"\n" +
+				"    Second paragraph.\n" +
+				"\n" +
+				"    1 file(s) changed, 2 insertion(s)(+), 0 deletion(s)(-)\n",
+		},
+		{
+			name:   "oneline",
+			format: "oneline",
+			want:   short + " Add a (+2/-0)\n",
+		},
+		{
+			name:     "template",
+			format:   "medium",
+			template: `{{.ShortHash}} {{.Author}} +{{.Added}}/-{{.Deleted}}{{range .Files}} {{.Name}}{{end}} {{.Body | indent "> "}}`,
+			want:     short + " Test Author +2/-0 a.txt > First paragraph\n> still first.\n\n> Second paragraph.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logFormat = tt.format
+			logTemplate = tt.template
+			output := captureStdout(func() { runLog(nil, []string{dir}) })
+			assert.Equal(t, tt.want, output)
+		})
+	}
+
+	// JSON lines can be decoded one commit at a time
+	logFormat = "jsonl"
+	logTemplate = ""
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, 1, strings.Count(output, "\n"))
+	var entry logEntry
+	assert.NoError(t, json.Unmarshal([]byte(output), &entry))
+	assert.Equal(t, hash.String(), entry.Hash)
+	assert.Equal(t, dir, entry.Repository)
+	assert.Equal(t, "Add a", entry.Subject)
+	assert.Equal(t, "First paragraph\nstill first.\n\nSecond paragraph.", entry.Body)
+	assert.Equal(t, []logFile{{Name: "a.txt", Added: 2}}, entry.Files)
+
+	// Bad formats and templates are reported
+	logFormat = "short"
+	assert.Equal(t, "Error: invalid format \"short\" (must be oneline, medium, full or jsonl)\n", captureStdout(func() { runLog(nil, []string{dir}) }))
+	logFormat = "jsonl"
+	logTemplate = "{{.Hash}}"
+	assert.Equal(t, "Error: --template can't be combined with --format jsonl\n", captureStdout(func() { runLog(nil, []string{dir}) }))
+}
+
+func TestRunLogStatAndPatch(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	commitFiles(t, dir, worktree, map[string]string{"main.go": "package main\n", "notes.md": "one\n"}, "Add files", when)
+	commitFiles(t, dir, worktree, map[string]string{"main.go": "package main\n\nfunc main() {}\n", "notes.md": "two\n"}, "Change files", when.Add(time.Hour))
+
+	defer func() {
+		showStat = false
+		showPatch = false
+		colorMode = "auto"
+		filenamesRegex = ""
+		maxCount = -1
+	}()
+	maxCount = 1
+
+	showStat = true
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "    Change files\n\n"+
+		"    main.go  | 2 ++\n"+
+		"    notes.md | 2 +-\n"+
+		"    2 file(s) changed, 3 insertion(s)(+), 1 deletion(s)(-)\n")
+
+	// The filename filter limits both the stat and the patch
+	showPatch = true
+	filenamesRegex = `\.go$`
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "    main.go | 2 ++\n    1 file(s) changed, 2 insertion(s)(+), 0 deletion(s)(-)\n")
+	assert.Contains(t, output, "diff --git a/main.go b/main.go\n")
+	assert.Contains(t, output, "@@ -1 +1,3 @@\n package main\n+\n+func main() {}\n")
+	assert.NotContains(t, output, "notes.md")
+	assert.NotContains(t, output, "\x1b[")
+
+	// Root commits are diffed against nothing
+	maxCount = -1
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "--- /dev/null\n+++ b/main.go\n")
+
+	// Colour is used when asked for
+	colorMode = "always"
+	maxCount = 1
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "2 "+colorGreen+"++"+colorReset)
+	assert.Contains(t, output, "\x1b[32m+func main() {}")
+	assert.Contains(t, output, "\n"+colorYellow+"commit ")
+	assert.Contains(t, output, "Author: "+colorCyan+"Test Author"+colorReset+" <test@example.com>\n")
+	assert.Contains(t, output, "1 file(s) changed, "+colorGreen+"2"+colorReset+" insertion(s)(+), "+colorRed+"0"+colorReset+" deletion(s)(-)\n")
+}
+
+func TestRunLogInterleave(t *testing.T) {
+	root := t.TempDir()
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	// Two repositories whose commits alternate in time
+	var dirs []string
+	for i, name := range []string{"api", "web"} {
+		dir := filepath.Join(root, name)
+		repo, err := git.PlainInit(dir, false)
+		assert.NoError(t, err)
+		worktree, err := repo.Worktree()
+		assert.NoError(t, err)
+		for j := 0; j < 3; j++ {
+			hour := time.Duration(2*j+i) * time.Hour
+			commitFiles(t, dir, worktree, map[string]string{"file.txt": fmt.Sprintf("%d\n", j)},
+				fmt.Sprintf("%s commit %d", name, j), when.Add(hour))
+		}
+		dirs = append(dirs, dir)
+	}
+
+	defer func() {
+		interleave = false
+		logFormat = "medium"
+		maxCount = -1
+		skip = 0
+	}()
+	interleave = true
+	logFormat = "oneline"
+
+	subjects := func(output string) []string {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			fields := strings.Fields(line)
+			lines = append(lines, fields[0]+" "+strings.Join(fields[2:5], " "))
+		}
+		return lines
+	}
+
+	output := captureStdout(func() { runLog(nil, dirs) })
+	assert.Equal(t, []string{
+		"[web] web commit 2",
+		"[api] api commit 2",
+		"[web] web commit 1",
+		"[api] api commit 1",
+		"[web] web commit 0",
+		"[api] api commit 0",
+	}, subjects(output))
+	assert.NotContains(t, output, "Repository:")
+
+	// Limits apply to the merged history
+	maxCount = 2
+	skip = 1
+	output = captureStdout(func() { runLog(nil, dirs) })
+	assert.Equal(t, []string{"[api] api commit 2", "[web] web commit 1"}, subjects(output))
+
+	// Filters still apply per commit, and other formats name the repository too
+	maxCount = -1
+	skip = 0
+	logFormat = "medium"
+	grepPatterns = []string{"commit 0"}
+	defer func() { grepPatterns = nil }()
+	output = captureStdout(func() { runLog(nil, []string{dirs[0], dirs[1] + "@master"}) })
+	assert.Equal(t, 2, strings.Count(output, "\ncommit "))
+	assert.Less(t, strings.Index(output, "Repo:   web@master"), strings.Index(output, "Repo:   api\n"))
+}
+
+func TestRunLogInterleaveDateField(t *testing.T) {
+	root := t.TempDir()
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	// web's commit was written later, but api's landed later
+	var dirs []string
+	for i, name := range []string{"api", "web"} {
+		dir := filepath.Join(root, name)
+		repo, err := git.PlainInit(dir, false)
+		assert.NoError(t, err)
+		worktree, err := repo.Worktree()
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte(name+"\n"), 0644))
+		_, err = worktree.Add("file.txt")
+		assert.NoError(t, err)
+		_, err = worktree.Commit(name+" commit", &git.CommitOptions{
+			Author:    &object.Signature{Name: "Test Author", Email: "test@example.com", When: when.Add(time.Duration(i) * time.Hour)},
+			Committer: &object.Signature{Name: "Test Author", Email: "test@example.com", When: when.Add(time.Duration(5-i) * time.Hour)},
+		})
+		assert.NoError(t, err)
+		dirs = append(dirs, dir)
+	}
+
+	defer func() {
+		interleave = false
+		logFormat = "medium"
+		dateField = "author"
+	}()
+	interleave = true
+	logFormat = "oneline"
+
+	// The timeline follows the dates it is filtered on and shows
+	subjects := func() []string {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(captureStdout(func() { runLog(nil, dirs) })), "\n") {
+			lines = append(lines, strings.Fields(line)[0])
+		}
+		return lines
+	}
+	dateField = "author"
+	assert.Equal(t, []string{"[web]", "[api]"}, subjects())
+	dateField = "committer"
+	assert.Equal(t, []string{"[api]", "[web]"}, subjects())
+}
+
+// graphRows keeps only the graph, decorations and subjects of oneline log
+// output, as short hashes vary
+func graphRows(output string) []string {
+	var rows []string
+	for _, row := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if i := strings.IndexFunc(row, func(r rune) bool { return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' }); i >= 0 {
+			row = row[:i] + row[i+7:]
+		}
+		row, _, _ = strings.Cut(row, " (+")
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestRunLogGraph(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	// A feature branch merged back into master, with a tag at its base
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	commitFiles(t, dir, worktree, map[string]string{"base.txt": "base\n"}, "Base", when)
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	_, err = repo.CreateTag("v1", head.Hash(), nil)
+	assert.NoError(t, err)
+
+	feature := plumbing.NewBranchReferenceName("feature")
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: feature, Create: true}))
+	commitFiles(t, dir, worktree, map[string]string{"feature.txt": "feature\n"}, "Feature", when.Add(time.Hour))
+	featureHead, err := repo.Head()
+	assert.NoError(t, err)
+
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}))
+	commitFiles(t, dir, worktree, map[string]string{"main.txt": "main\n"}, "Main", when.Add(2*time.Hour))
+	mainHead, err := repo.Head()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "feature.txt"), []byte("feature\n"), 0644))
+	_, err = worktree.Add("feature.txt")
+	assert.NoError(t, err)
+	_, err = worktree.Commit("Merge feature", &git.CommitOptions{
+		Author:  &object.Signature{Name: "Test Author", Email: "test@example.com", When: when.Add(3 * time.Hour)},
+		Parents: []plumbing.Hash{mainHead.Hash(), featureHead.Hash()},
+	})
+	assert.NoError(t, err)
+
+	defer func() {
+		showGraph = false
+		decorate = false
+		logFormat = "medium"
+		logTemplate = ""
+		grepPatterns = nil
+	}()
+	showGraph = true
+	logFormat = "oneline"
+
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, []string{
+		"*  (HEAD -> master) Merge feature",
+		"|\\",
+		"* |  Main",
+		"| *  (feature) Feature",
+		"|/",
+		"*  (tag: v1) Base",
+	}, graphRows(output))
+
+	// Lines are drawn through commits that aren't shown
+	grepPatterns = []string{"Merge|Base"}
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, []string{
+		"*  (HEAD -> master) Merge feature",
+		"|\\",
+		"|/",
+		"*  (tag: v1) Base",
+	}, graphRows(output))
+	grepPatterns = nil
+
+	// Medium format continues the graph beside the whole entry
+	logFormat = "medium"
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "|\\\n| | Author: Test Author <test@example.com>\n")
+	assert.Contains(t, output, "| * commit "+featureHead.Hash().String()+" (feature)\n")
+
+	// Decorations can be shown without the graph
+	showGraph = false
+	decorate = true
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "\ncommit "+featureHead.Hash().String()+" (feature)\n")
+
+	logFormat = "jsonl"
+	showGraph = true
+	assert.Equal(t, "Error: --graph needs the oneline, medium or full format\n", captureStdout(func() { runLog(nil, []string{dir}) }))
+}
+
+func TestRunLogGraphCrossingLanes(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	commit := func(name string, hour int) {
+		commitFiles(t, dir, worktree, map[string]string{name + ".txt": name + "\n"}, name, when.Add(time.Duration(hour)*time.Hour))
+	}
+	checkout := func(branch string, create bool) {
+		assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(branch), Create: create}))
+	}
+	merge := func(branch string, hour int) {
+		head, err := repo.Head()
+		assert.NoError(t, err)
+		other, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+		assert.NoError(t, err)
+		_, err = worktree.Commit("Merge "+branch, &git.CommitOptions{
+			Author:            &object.Signature{Name: "Test Author", Email: "test@example.com", When: when.Add(time.Duration(hour) * time.Hour)},
+			Parents:           []plumbing.Hash{head.Hash(), other.Hash()},
+			AllowEmptyCommits: true,
+		})
+		assert.NoError(t, err)
+	}
+
+	// b1 branches off before P and b2 after it, so b2's lane has to cross
+	// b1's to reach P
+	commit("Base", 0)
+	checkout("b1", true)
+	commit("Q", 1)
+	checkout("master", false)
+	commit("P", 2)
+	checkout("b2", true)
+	commit("R", 3)
+	checkout("master", false)
+	merge("b1", 4)
+	merge("b2", 5)
+
+	defer func() {
+		showGraph = false
+		decorate = false
+		logFormat = "medium"
+	}()
+	showGraph = true
+	logFormat = "oneline"
+
+	// A lane moves one column per row, as in git log --graph --date-order
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, []string{
+		"*  (HEAD -> master) Merge b2",
+		"|\\",
+		"* |  Merge b1",
+		"|\\ \\",
+		"| | *  (b2) R",
+		"| |/",
+		"|/|",
+		"* |  P",
+		"| *  (b1) Q",
+		"|/",
+		"*  Base",
+	}, graphRows(output))
+}
+
+func TestRunLogPickaxe(t *testing.T) {
+	dir := setupPickaxeRepo(t, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC))
+
+	defer func() {
+		logFormat = "medium"
+		pickaxeString = ""
+		pickaxeRegex = ""
+	}()
+	logFormat = "oneline"
+
+	subjects := func(output string) []string {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			lines = append(lines, line[8:])
+		}
+		return lines
+	}
+
+	// Log shows the whole changes of the files picked out
+	pickaxeString = "oldAPI"
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, []string{"Change by Bob (+1/-1)", "Change by Alice (+3/-0)"}, subjects(output))
+
+	pickaxeString = ""
+	pickaxeRegex = `z := `
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, []string{"Change by Carol (+1/-1)"}, subjects(output))
+}
+
+func TestRunLogFollow(t *testing.T) {
+	dir := setupRenameRepo(t, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC))
+
+	defer func() {
+		logFormat = "medium"
+		followFile = ""
+		showStat = false
+		showPatch = false
+	}()
+	logFormat = "oneline"
+	followFile = "new.go"
+
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	var subjects []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		subjects = append(subjects, line[8:])
+	}
+	assert.Equal(t, []string{
+		"Extend new.go (+2/-0)",
+		"Rename old.go to new.go (+1/-1)",
+		"Create old.go (+10/-0)",
+	}, subjects)
+
+	// Stats name the file as it was then, and the diff shows the rename
+	showStat = true
+	showPatch = true
+	output = captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Contains(t, output, "rename from old.go\nrename to new.go\n")
+	assert.Contains(t, output, " old.go | 10 ++++++++++\n")
+	assert.NotContains(t, output, "other.go")
+}
+
+func TestRunLogGraphEqualDates(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	// Every commit has the same date, so only the topology orders them
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	commit := func(name string) {
+		commitFiles(t, dir, worktree, map[string]string{name + ".txt": name + "\n"}, name, when)
+	}
+	commit("c1")
+	commit("c2")
+	feat := plumbing.NewBranchReferenceName("feat")
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: feat, Create: true}))
+	commit("f1")
+	commit("f2")
+	featHead, err := repo.Head()
+	assert.NoError(t, err)
+	assert.NoError(t, worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.Master}))
+	commit("c3")
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	_, err = worktree.Commit("Merge feat", &git.CommitOptions{
+		Author:            &object.Signature{Name: "Test Author", Email: "test@example.com", When: when},
+		Parents:           []plumbing.Hash{head.Hash(), featHead.Hash()},
+		AllowEmptyCommits: true,
+	})
+	assert.NoError(t, err)
+
+	defer func() {
+		showGraph = false
+		decorate = false
+		logFormat = "medium"
+	}()
+	showGraph = true
+	logFormat = "oneline"
+
+	// Every commit is drawn before its parents, so the branch joins back up
+	output := captureStdout(func() { runLog(nil, []string{dir}) })
+	assert.Equal(t, []string{
+		"*  (HEAD -> master) Merge feat",
+		"|\\",
+		"| *  (feat) f2",
+		"| *  f1",
+		"* |  c3",
+		"|/",
+		"*  c2",
+		"*  c1",
+	}, graphRows(output))
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	logFormat   string
+	logTemplate string
+)
+
+// logFile is a file changed by a commit, as shown by grit log
+type logFile struct {
+	Name    string
+	Added   int
+	Deleted int
+}
+
+// logEntry is a commit as shown by grit log. Its fields are available to
+// --template and are what --format jsonl writes.
+type logEntry struct {
+	Repository     string
+	Hash           string
+	ShortHash      string
+	Parents        []string
+	Author         string
+	AuthorEmail    string
+	AuthorDate     time.Time
+	Committer      string
+	CommitterEmail string
+	CommitterDate  time.Time
+	Date           time.Time // AuthorDate or CommitterDate, as chosen by --date-field
+	Subject        string
+	Body           string
+	Message        string
+	Added          int64
+	Deleted        int64
+	Files          []logFile
+	Refs           []string `json:",omitempty"` // branches and tags pointing here, with --decorate or --graph
+	Patch          string   `json:",omitempty"` // unified diff, with --patch
+}
+
+// newLogEntry describes a selected commit from the repository at path spec repo
+func newLogEntry(repo string, sc *selectedCommit, dateField string) *logEntry {
+	c := sc.Commit
+	subject, body, _ := strings.Cut(strings.TrimRight(c.Message, "\n"), "\n")
+
+	e := &logEntry{
+		Repository:     repo,
+		Hash:           c.Hash.String(),
+		ShortHash:      c.Hash.String()[:7],
+		Author:         c.Author.Name,
+		AuthorEmail:    c.Author.Email,
+		AuthorDate:     c.Author.When,
+		Committer:      c.Committer.Name,
+		CommitterEmail: c.Committer.Email,
+		CommitterDate:  c.Committer.When,
+		Date:           commitDate(c, dateField),
+		Subject:        subject,
+		Body:           strings.TrimLeft(body, "\n"),
+		Message:        c.Message,
+		Files:          []logFile{},
+	}
+	for _, parent := range c.ParentHashes {
+		e.Parents = append(e.Parents, parent.String())
+	}
+	e.Added, e.Deleted = sc.totals()
+	for _, stat := range sc.Files {
+		e.Files = append(e.Files, logFile{Name: stat.Name, Added: stat.Addition, Deleted: stat.Deletion})
+	}
+	return e
+}
+
+// logPrinter writes commits in the chosen --format or --template
+type logPrinter struct {
+	w      io.Writer
+	format string
+	tmpl   *template.Template
+	stat   bool      // list each file's changes in human-oriented formats
+	tag    bool      // name each commit's repository in human-oriented formats
+	graph  *logGraph // draw the history's topology beside each commit
+	color  bool
+}
+
+// logTemplateFuncs are the functions available to --template, beyond the
+// text/template builtins
+var logTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"indent": indentLines,
+}
+
+// newLogPrinter checks the format and compiles the template, if any
+func newLogPrinter(w io.Writer, format, tmpl string) (*logPrinter, error) {
+	p := &logPrinter{w: w, format: format}
+	if tmpl != "" {
+		if format != "medium" {
+			return nil, fmt.Errorf("--template can't be combined with --format %s", format)
+		}
+		t, err := template.New("log").Funcs(logTemplateFuncs).Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template: %w", err)
+		}
+		p.tmpl = t
+		return p, nil
+	}
+
+	switch format {
+	case "oneline", "medium", "full", "jsonl":
+		return p, nil
+	}
+	return nil, fmt.Errorf("invalid format %q (must be oneline, medium, full or jsonl)", format)
+}
+
+// human reports whether the output is for people, and so may be coloured
+// and should separate repositories with a header. Machine-readable output
+// names the repository in each entry instead.
+func (p *logPrinter) human() bool {
+	return p.tmpl == nil && p.format != "jsonl"
+}
+
+// print writes a single commit, beside the graph if one is drawn. It
+// returns any error writing it, such as a broken pipe once the reader has
+// quit the pager.
+func (p *logPrinter) print(e *logEntry) error {
+	var sb strings.Builder
+	if err := p.write(&sb, e); err != nil {
+		return err
+	}
+	if p.graph == nil {
+		_, err := io.WriteString(p.w, sb.String())
+		return err
+	}
+
+	// The blank line medium and full put before each commit goes after it
+	// instead, so that it continues the graph
+	text := strings.Split(strings.TrimRight(strings.TrimLeft(sb.String(), "\n"), "\n"), "\n")
+	if p.format != "oneline" {
+		text = append(text, "")
+	}
+	for _, row := range p.graph.render(e.Hash, e.Parents, text) {
+		if _, err := fmt.Fprintln(p.w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip keeps the graph's lines running through a commit that isn't shown
+func (p *logPrinter) skip(c *object.Commit) {
+	if p.graph == nil {
+		return
+	}
+	parents := make([]string, 0, len(c.ParentHashes))
+	for _, parent := range c.ParentHashes {
+		parents = append(parents, parent.String())
+	}
+	p.graph.skip(c.Hash.String(), parents)
+}
+
+// write formats a single commit to w. Write errors are only returned from
+// templates, so w should be a buffer.
+func (p *logPrinter) write(w io.Writer, e *logEntry) error {
+	if p.tmpl != nil {
+		if err := p.tmpl.Execute(w, e); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+
+	switch p.format {
+	case "oneline":
+		if p.tag {
+			fmt.Fprintf(w, "[%s] ", repositoryLabel(e.Repository))
+		}
+		fmt.Fprintf(w, "%s %s (%s)\n", colorize(e.ShortHash+decoration(e.Refs), colorYellow, p.color),
+			e.Subject, colorCounts(e.Added, e.Deleted, p.color))
+		if p.stat {
+			for _, line := range statLines(e.Files, statWidth-1, p.color) {
+				fmt.Fprintf(w, " %s\n", line)
+			}
+		}
+		fmt.Fprint(w, e.Patch)
+	case "jsonl":
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", data)
+	default:
+		fmt.Fprintf(w, "\n%s\n", colorize("commit "+e.Hash+decoration(e.Refs), colorYellow, p.color))
+		if p.tag {
+			fmt.Fprintf(w, "Repo:   %s\n", repositoryLabel(e.Repository))
+		}
+		fmt.Fprintf(w, "Author: %s <%s>\n", colorize(e.Author, colorCyan, p.color), e.AuthorEmail)
+		if p.format == "full" {
+			// As in git, full names the committer instead of giving a date
+			fmt.Fprintf(w, "Commit: %s <%s>\n", e.Committer, e.CommitterEmail)
+		} else {
+			fmt.Fprintf(w, "Date:   %s\n", e.Date.Format(time.RFC3339))
+		}
+		fmt.Fprintf(w, "\n%s\n\n", indentLines("    ", e.Message))
+		if p.stat {
+			for _, line := range statLines(e.Files, statWidth-4, p.color) {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+		fmt.Fprintf(w, "    %d file(s) changed, %s insertion(s)(+), %s deletion(s)(-)\n", len(e.Files),
+			colorize(fmt.Sprint(e.Added), colorGreen, p.color), colorize(fmt.Sprint(e.Deleted), colorRed, p.color))
+		if e.Patch != "" {
+			fmt.Fprintf(w, "\n%s", e.Patch)
+		}
+	}
+	return nil
+}
+
+// decoration formats the refs pointing at a commit as git does, e.g.
+// " (HEAD -> main, tag: v1.0)", or returns an empty string if there are none
+func decoration(refs []string) string {
+	if len(refs) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(refs, ", ") + ")"
+}
+
+// repositoryLabel names the repository of a path spec briefly: the
+// repository's directory name, with the branch if one was given
+func repositoryLabel(pathSpec string) string {
+	spec := parseRevisionSpec(pathSpec)
+	name := spec.Path
+	if abs, err := filepath.Abs(spec.Path); err == nil {
+		name = filepath.Base(abs)
+	}
+	if spec.Branch != "" {
+		name += "@" + spec.Branch
+	}
+	return name
+}
+
+// indentLines prefixes every non-empty line of text, dropping trailing newlines
+func indentLines(prefix, text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"container/heap"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// logOrder reads the history from a commit in the order it is shown
+type logOrder func(repo *git.Repository, from plumbing.Hash) (object.CommitIter, error)
+
+// defaultOrder reads a history in go-git's default order, depth first
+func defaultOrder(repo *git.Repository, from plumbing.Hash) (object.CommitIter, error) {
+	return repo.Log(&git.LogOptions{From: from})
+}
+
+// dateOrder returns an order that reads a history newest first by a commit
+// date, as chosen by --date-field. Commits are read as they are reached, so
+// histories are never loaded whole.
+func dateOrder(field string) logOrder {
+	return func(repo *git.Repository, from plumbing.Hash) (object.CommitIter, error) {
+		c, err := repo.CommitObject(from)
+		if err != nil {
+			return nil, err
+		}
+		it := &dateOrderIter{
+			repo:  repo,
+			queue: &commitHeap{newer: newerBy(field)},
+			seen:  map[plumbing.Hash]bool{c.Hash: true},
+		}
+		heap.Push(it.queue, c)
+		return it, nil
+	}
+}
+
+// newerBy returns whether a commit comes before another newest first by a
+// commit date, then by hash so that the order is stable
+func newerBy(field string) func(a, b *object.Commit) bool {
+	return func(a, b *object.Commit) bool {
+		da, db := commitDate(a, field), commitDate(b, field)
+		if !da.Equal(db) {
+			return da.After(db)
+		}
+		return a.Hash.String() < b.Hash.String()
+	}
+}
+
+// commitHeap holds commits waiting to be read, the first in order on top
+type commitHeap struct {
+	commits []*object.Commit
+	newer   func(a, b *object.Commit) bool
+}
+
+func (h *commitHeap) Len() int { return len(h.commits) }
+
+func (h *commitHeap) Less(i, j int) bool { return h.newer(h.commits[i], h.commits[j]) }
+
+func (h *commitHeap) Swap(i, j int) { h.commits[i], h.commits[j] = h.commits[j], h.commits[i] }
+
+func (h *commitHeap) Push(x interface{}) { h.commits = append(h.commits, x.(*object.Commit)) }
+
+func (h *commitHeap) Pop() interface{} {
+	old := h.commits
+	c := old[len(old)-1]
+	h.commits = old[:len(old)-1]
+	return c
+}
+
+// dateOrderIter reads a history newest first, queueing the parents of each
+// commit as it is read
+type dateOrderIter struct {
+	repo  *git.Repository
+	queue *commitHeap
+	seen  map[plumbing.Hash]bool
+}
+
+func (it *dateOrderIter) Next() (*object.Commit, error) {
+	if it.queue.Len() == 0 {
+		return nil, io.EOF
+	}
+	c := heap.Pop(it.queue).(*object.Commit)
+	for _, hash := range c.ParentHashes {
+		if it.seen[hash] {
+			continue
+		}
+		it.seen[hash] = true
+		parent, err := it.repo.CommitObject(hash)
+		if err == plumbing.ErrObjectNotFound {
+			// The history of a shallow clone stops here
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		heap.Push(it.queue, parent)
+	}
+	return c, nil
+}
+
+func (it *dateOrderIter) ForEach(cb func(*object.Commit) error) error {
+	return forEachCommit(it, cb)
+}
+
+func (it *dateOrderIter) Close() {}
+
+// topoOrder reads a history as git log --topo-order does: no commit before
+// all of its children, and otherwise newest first by committer date. Unlike
+// the date orders, it has to walk the whole history before it can return the
+// first commit, as clocks can be skewed or equal.
+func topoOrder(repo *git.Repository, from plumbing.Hash) (object.CommitIter, error) {
+	c, err := repo.CommitObject(from)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the children of every commit in the history
+	commits := map[plumbing.Hash]*object.Commit{c.Hash: c}
+	children := make(map[plumbing.Hash]int)
+	walk := []*object.Commit{c}
+	for len(walk) > 0 {
+		c := walk[len(walk)-1]
+		walk = walk[:len(walk)-1]
+		for _, hash := range c.ParentHashes {
+			children[hash]++
+			if _, ok := commits[hash]; ok {
+				continue
+			}
+			parent, err := repo.CommitObject(hash)
+			if err == plumbing.ErrObjectNotFound {
+				// The history of a shallow clone stops here
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			commits[hash] = parent
+			walk = append(walk, parent)
+		}
+	}
+
+	it := &topoOrderIter{
+		commits:  commits,
+		children: children,
+		ready:    &commitHeap{newer: newerBy("committer")},
+	}
+	heap.Push(it.ready, commits[from])
+	return it, nil
+}
+
+// topoOrderIter reads a walked history, releasing each commit once all of
+// its children have been read
+type topoOrderIter struct {
+	commits  map[plumbing.Hash]*object.Commit
+	children map[plumbing.Hash]int // children not yet read
+	ready    *commitHeap
+}
+
+func (it *topoOrderIter) Next() (*object.Commit, error) {
+	if it.ready.Len() == 0 {
+		return nil, io.EOF
+	}
+	c := heap.Pop(it.ready).(*object.Commit)
+	for _, hash := range c.ParentHashes {
+		parent, ok := it.commits[hash]
+		if !ok {
+			continue
+		}
+		it.children[hash]--
+		if it.children[hash] == 0 {
+			heap.Push(it.ready, parent)
+		}
+	}
+	return c, nil
+}
+
+func (it *topoOrderIter) ForEach(cb func(*object.Commit) error) error {
+	return forEachCommit(it, cb)
+}
+
+func (it *topoOrderIter) Close() {}
+
+// forEachCommit calls cb with every commit of it until the end of the
+// history, or until cb returns storer.ErrStop
+func forEachCommit(it object.CommitIter, cb func(*object.Commit) error) error {
+	for {
+		c, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := cb(c); err == storer.ErrStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
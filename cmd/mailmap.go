@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// mailmapFileName is the file in the repository root that maps the names
+// and emails commits were made with to canonical ones, as in git
+const mailmapFileName = ".mailmap"
+
+// mailmap maps the names and emails commits were made with to each person's
+// canonical name and email (see gitmailmap(5))
+type mailmap struct {
+	entries []mailmapEntry
+}
+
+// mailmapEntry is one line of a mailmap. An empty proper name or email is
+// left as committed; an empty commit name matches any name.
+type mailmapEntry struct {
+	properName, properEmail string
+	commitName, commitEmail string
+}
+
+// parseMailmap reads a mailmap, in any of the forms:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func parseMailmap(r io.Reader) (*mailmap, error) {
+	m := &mailmap{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name1, email1, rest, ok := cutMailmapIdent(line)
+		if !ok {
+			continue
+		}
+		entry := mailmapEntry{properName: name1, commitEmail: email1}
+		if name2, email2, _, ok := cutMailmapIdent(rest); ok {
+			entry = mailmapEntry{properName: name1, properEmail: email1, commitName: name2, commitEmail: email2}
+		}
+		m.entries = append(m.entries, entry)
+	}
+	return m, scanner.Err()
+}
+
+// cutMailmapIdent splits "Name <email> rest" into its parts
+func cutMailmapIdent(s string) (name, email, rest string, ok bool) {
+	before, after, ok := strings.Cut(s, "<")
+	if !ok {
+		return "", "", "", false
+	}
+	email, rest, ok = strings.Cut(after, ">")
+	if !ok {
+		return "", "", "", false
+	}
+	return strings.TrimSpace(before), strings.TrimSpace(email), rest, true
+}
+
+// resolve returns the canonical identity for a signature. Entries naming
+// both the commit name and email take precedence over those naming only the
+// email; both are matched regardless of case.
+func (m *mailmap) resolve(sig object.Signature) object.Signature {
+	if m == nil {
+		return sig
+	}
+	var match *mailmapEntry
+	for i, e := range m.entries {
+		if !strings.EqualFold(e.commitEmail, sig.Email) {
+			continue
+		}
+		if e.commitName != "" {
+			if strings.EqualFold(e.commitName, sig.Name) {
+				match = &m.entries[i]
+				break
+			}
+		} else if match == nil {
+			match = &m.entries[i]
+		}
+	}
+	if match == nil {
+		return sig
+	}
+	if match.properName != "" {
+		sig.Name = match.properName
+	}
+	if match.properEmail != "" {
+		sig.Email = match.properEmail
+	}
+	return sig
+}
+
+// readMailmap reads a repository's mailmap from its working tree or, for a
+// bare repository, from the commit its history is read from. A repository
+// without one gets an empty mailmap.
+func readMailmap(repo *git.Repository, path string, tip *object.Commit) *mailmap {
+	if _, err := repo.Worktree(); err == nil {
+		if f, err := os.Open(filepath.Join(path, mailmapFileName)); err == nil {
+			defer f.Close()
+			if m, err := parseMailmap(f); err == nil {
+				return m
+			}
+		}
+		return &mailmap{}
+	}
+
+	if tip != nil {
+		if file, err := tip.File(mailmapFileName); err == nil {
+			if r, err := file.Reader(); err == nil {
+				defer r.Close()
+				if m, err := parseMailmap(r); err == nil {
+					return m
+				}
+			}
+		}
+	}
+	return &mailmap{}
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ownershipFormat string
+	ownershipDepth  int
+	ownershipCmd    = &cobra.Command{
+		Use:   "ownership [paths...] [-- pathspec...]",
+		Short: "Show each author's share of the lines that exist at a revision, by directory",
+		Long: `Blame every text file in the repositories at paths, each optionally followed by
+@revision (default HEAD), and show each author's share of the surviving lines:
+in total, and for each directory down to --depth levels. Pathspecs after "--"
+and --filenames-regex limit the files blamed. Authors are mapped through each
+repository's .mailmap.
+
+Blames are cached per file path and the commit it last changed in, and those
+commits per revision, so after the first run history is only walked back to
+the last revision seen, and only the files changed since are blamed again.
+
+--format json writes Revisions (the commit each path was read at), Total and
+Directories, each with Lines and Authors (each with Author, Lines, Files and
+Share, a fraction of the group's lines).`,
+		Run: runOwnership,
+	}
+)
+
+func init() {
+	countCmd.AddCommand(ownershipCmd)
+	ownershipCmd.Flags().StringVarP(&remoteName, "remote", "r", "", "Remote name to use for branch references")
+	ownershipCmd.Flags().StringVarP(&filenamesRegex, "filenames-regex", "f", "", "Only blame files matching this regex")
+	ownershipCmd.Flags().IntVar(&ownershipDepth, "depth", 1, "Directory levels to break ownership down by (0 for the total only)")
+	ownershipCmd.Flags().StringVar(&ownershipFormat, "format", "table", "Output format: table or json")
+	ownershipCmd.Flags().BoolVarP(&noCache, "no-cache", "n", false, "Blame every file afresh, without reading or saving cached blames")
+}
+
+// ownershipShare is an author's part of a group of lines
+type ownershipShare struct {
+	Author string
+	Lines  int
+	Files  int
+	Share  float64 // fraction of the group's lines
+}
+
+// ownershipGroup is the ownership of the lines in a directory, or of all of them
+type ownershipGroup struct {
+	Directory string `json:",omitempty"`
+	Lines     int
+	Authors   []ownershipShare
+}
+
+// ownershipReport is the result of grit count ownership
+type ownershipReport struct {
+	Revisions   map[string]string // path spec -> commit hash it resolved to
+	Total       ownershipGroup
+	Directories []ownershipGroup
+}
+
+// newOwnershipGroup computes each author's share of a tally
+func newOwnershipGroup(dir string, owners lineOwners) ownershipGroup {
+	group := ownershipGroup{Directory: dir, Authors: []ownershipShare{}}
+	sorted := owners.sorted()
+	for _, owner := range sorted {
+		group.Lines += owner.Lines
+	}
+	for _, owner := range sorted {
+		group.Authors = append(group.Authors, ownershipShare{
+			Author: owner.Author,
+			Lines:  owner.Lines,
+			Files:  owner.Files,
+			Share:  float64(owner.Lines) / float64(max(group.Lines, 1)),
+		})
+	}
+	return group
+}
+
+// ownershipDir returns the directory a file's lines are counted under: its
+// directory cut to depth levels, with a trailing slash, or "./" for files at
+// the top
+func ownershipDir(name string, depth int) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return "./"
+	}
+	parts := strings.Split(dir, "/")
+	return strings.Join(parts[:min(depth, len(parts))], "/") + "/"
+}
+
+func runOwnership(cmd *cobra.Command, args []string) {
+	args, pathspecs := splitPathspecs(cmd, args)
+	if len(args) == 0 {
+		args = []string{"./"}
+	}
+
+	if ownershipFormat != "table" && ownershipFormat != "json" {
+		fmt.Printf("Error: invalid format %q (must be table or json)\n", ownershipFormat)
+		return
+	}
+	if ownershipDepth < 0 {
+		fmt.Printf("Error: --depth must not be negative\n")
+		return
+	}
+
+	selection, err := newCommitSelection(CacheArgs{CoauthorCredit: "full", FilenamesRegex: filenamesRegex, Pathspecs: pathspecs})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	store := blameStore()
+	report := ownershipReport{Revisions: make(map[string]string)}
+	total := lineOwners{}
+	dirs := make(map[string]lineOwners)
+	for _, pathSpec := range args {
+		spec := parseRevisionSpec(pathSpec)
+		repo, err := git.PlainOpen(spec.Path)
+		if err != nil {
+			fmt.Printf("Error opening repository at %s: %v\n", spec.Path, err)
+			continue
+		}
+		ref, err := spec.resolve(repo, remoteName)
+		if err != nil {
+			fmt.Printf("Error resolving %s: %v\n", pathSpec, err)
+			continue
+		}
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			fmt.Printf("Error reading commit for %s: %v\n", pathSpec, err)
+			continue
+		}
+		report.Revisions[pathSpec] = commit.Hash.String()
+		mailmap := readMailmap(repo, spec.Path, commit)
+
+		files, err := treeFiles(commit, selection.selectsFile)
+		if err != nil {
+			fmt.Printf("Error listing files for %s: %v\n", pathSpec, err)
+			continue
+		}
+		blame, err := newFileBlamer(store, commit, files)
+		if err != nil {
+			fmt.Printf("Error reading history for %s: %v\n", pathSpec, err)
+			continue
+		}
+		for _, file := range files {
+			owners, err := blame(file)
+			if err != nil {
+				fmt.Printf("Error blaming %s in %s: %v\n", file.Name, pathSpec, err)
+				continue
+			}
+			total.addFile(owners, mailmap)
+			if ownershipDepth == 0 {
+				continue
+			}
+
+			dir := ownershipDir(file.Name, ownershipDepth)
+			if len(args) > 1 {
+				// Directories of different repositories are kept apart
+				dir = path.Join(repositoryLabel(pathSpec), dir) + "/"
+			}
+			if dirs[dir] == nil {
+				dirs[dir] = lineOwners{}
+			}
+			dirs[dir].addFile(owners, mailmap)
+		}
+	}
+
+	report.Total = newOwnershipGroup("", total)
+	report.Directories = []ownershipGroup{}
+	for dir, owners := range dirs {
+		report.Directories = append(report.Directories, newOwnershipGroup(dir, owners))
+	}
+	sort.Slice(report.Directories, func(i, j int) bool {
+		return report.Directories[i].Directory < report.Directories[j].Directory
+	})
+
+	if ownershipFormat == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error formatting report: %v\n", err)
+			return
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+	printOwnership(report)
+}
+
+// printOwnership writes the total ownership, then each directory's
+func printOwnership(report ownershipReport) {
+	columns := []tableColumn{
+		{header: "Directory"},
+		{header: "Lines", right: true},
+		{header: "Share", right: true},
+		{header: "Files", right: true},
+		{header: "Author", color: colorCyan},
+	}
+	var rows [][]string
+	for _, group := range append([]ownershipGroup{report.Total}, report.Directories...) {
+		dir := group.Directory
+		if dir == "" {
+			dir = "(total)"
+		}
+		for _, share := range group.Authors {
+			rows = append(rows, []string{
+				dir,
+				strconv.Itoa(share.Lines),
+				fmt.Sprintf("%.1f%%", 100*share.Share),
+				strconv.Itoa(share.Files),
+				share.Author,
+			})
+		}
+	}
+	writeTable(os.Stdout, columns, rows, colorEnabled())
+}
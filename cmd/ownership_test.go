@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOwnership(t *testing.T) {
+	t.Setenv(cacheDirEnv, t.TempDir())
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	dir := setupPickaxeRepo(t, when)
+	repo, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	commitFiles(t, dir, worktree, map[string]string{
+		"pkg/b.go":      "package pkg\n",
+		"pkg/util/a.go": "package util\n\nfunc A() {}\n",
+	}, "Add pkg", when.Add(4*time.Hour))
+	defer func() {
+		ownershipFormat = "table"
+		ownershipDepth = 1
+		noCache = false
+		filenamesRegex = ""
+	}()
+	ownershipFormat = "table"
+	ownershipDepth = 1
+
+	output := captureStdout(func() { runOwnership(ownershipCmd, []string{dir}) })
+	assert.Equal(t, ""+
+		"Directory  Lines   Share  Files  Author\n"+
+		"(total)        4   57.1%      2  Test Author <test@example.com>\n"+
+		"(total)        1   14.3%      1  Alice <alice@example.com>\n"+
+		"(total)        1   14.3%      1  Bob <bob@example.com>\n"+
+		"(total)        1   14.3%      1  Carol <carol@example.com>\n"+
+		"./             1   33.3%      1  Alice <alice@example.com>\n"+
+		"./             1   33.3%      1  Bob <bob@example.com>\n"+
+		"./             1   33.3%      1  Carol <carol@example.com>\n"+
+		"pkg/           4  100.0%      2  Test Author <test@example.com>\n", output)
+
+	// Blames were cached under the commit each file last changed in, and are
+	// reused for unchanged files
+	store, err := openCacheStore()
+	assert.NoError(t, err)
+	keys, err := store.Keys(blameBucket)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	assert.NoError(t, err)
+	last, err := lastChanges(store, commit, []string{"api.go", "pkg/b.go"})
+	assert.NoError(t, err)
+	assert.Equal(t, commit.ParentHashes[0], last["api.go"])
+	assert.Equal(t, commit.Hash, last["pkg/b.go"])
+	data, err := json.Marshal([]blameOwner{{Name: "Dave", Email: "dave@example.com", Lines: 3}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put(blameBucket, blameKey(last["api.go"], "api.go"), data))
+
+	rootCmd.SetArgs([]string{"count", "ownership", "--depth", "0", dir, "--", "*.go"})
+	output = captureStdout(func() { assert.NoError(t, rootCmd.Execute()) })
+	assert.Equal(t, ""+
+		"Directory  Lines   Share  Files  Author\n"+
+		"(total)        3  100.0%      1  Dave <dave@example.com>\n", output)
+
+	rootCmd.SetArgs([]string{"count", "ownership", "--no-cache", "--depth", "0", dir, "--", "*.go"})
+	output = captureStdout(func() { assert.NoError(t, rootCmd.Execute()) })
+	assert.Equal(t, ""+
+		"Directory  Lines  Share  Files  Author\n"+
+		"(total)        1  33.3%      1  Alice <alice@example.com>\n"+
+		"(total)        1  33.3%      1  Bob <bob@example.com>\n"+
+		"(total)        1  33.3%      1  Carol <carol@example.com>\n", output)
+
+	// JSON, broken down two levels deep
+	ownershipFormat = "json"
+	ownershipDepth = 2
+	filenamesRegex = `^pkg/`
+	output = captureStdout(func() { runOwnership(ownershipCmd, []string{dir}) })
+	var report ownershipReport
+	assert.NoError(t, json.Unmarshal([]byte(output), &report))
+	assert.Equal(t, map[string]string{dir: head.Hash().String()}, report.Revisions)
+	assert.Equal(t, 4, report.Total.Lines)
+	assert.Equal(t, []ownershipGroup{
+		{Directory: "pkg/", Lines: 1, Authors: []ownershipShare{{Author: "Test Author <test@example.com>", Lines: 1, Files: 1, Share: 1}}},
+		{Directory: "pkg/util/", Lines: 3, Authors: []ownershipShare{{Author: "Test Author <test@example.com>", Lines: 3, Files: 1, Share: 1}}},
+	}, report.Directories)
+
+	ownershipFormat = "csv"
+	output = captureStdout(func() { runOwnership(ownershipCmd, []string{dir}) })
+	assert.Equal(t, "Error: invalid format \"csv\" (must be table or json)\n", output)
+}
+
+func TestRunOwnershipCacheKeepsHistoriesApart(t *testing.T) {
+	t.Setenv(cacheDirEnv, t.TempDir())
+	defer func() {
+		ownershipFormat = "table"
+		ownershipDepth = 1
+	}()
+	ownershipFormat = "table"
+	ownershipDepth = 0
+
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	commitLicense := func(dir, author, content string) {
+		repo, err := git.PlainOpen(dir)
+		assert.NoError(t, err)
+		worktree, err := repo.Worktree()
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "LICENSE"), []byte(content), 0644))
+		_, err = worktree.Add("LICENSE")
+		assert.NoError(t, err)
+		_, err = worktree.Commit("Update LICENSE", &git.CommitOptions{
+			Author: &object.Signature{Name: author, Email: strings.ToLower(author) + "@example.com", When: when},
+		})
+		assert.NoError(t, err)
+	}
+	ownership := func(dir string) string {
+		return captureStdout(func() { runOwnership(ownershipCmd, []string{dir}) })
+	}
+
+	// Two repositories with the same file, committed by different authors
+	var dirs []string
+	for _, author := range []string{"Alice", "Bob"} {
+		dir := t.TempDir()
+		_, err := git.PlainInit(dir, false)
+		assert.NoError(t, err)
+		commitLicense(dir, author, "MIT License\n")
+		dirs = append(dirs, dir)
+	}
+	for i, author := range []string{"Alice <alice@example.com>", "Bob <bob@example.com>"} {
+		for run := 0; run < 2; run++ {
+			assert.Equal(t, ""+
+				"Directory  Lines   Share  Files  Author\n"+
+				"(total)        1  100.0%      1  "+author+"\n", ownership(dirs[i]), "run %d", run)
+		}
+	}
+
+	// Reverting the file to content blamed before credits the revert
+	commitLicense(dirs[0], "Carol", "Apache License\n")
+	commitLicense(dirs[0], "Dave", "MIT License\n")
+	assert.Equal(t, ""+
+		"Directory  Lines   Share  Files  Author\n"+
+		"(total)        1  100.0%      1  Dave <dave@example.com>\n", ownership(dirs[0]))
+}
+
+func TestRunOwnershipWarmRunWalksNoHistory(t *testing.T) {
+	t.Setenv(cacheDirEnv, t.TempDir())
+	defer func() {
+		ownershipFormat = "table"
+		ownershipDepth = 1
+	}()
+	ownershipFormat = "table"
+	ownershipDepth = 0
+
+	when := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	dir := setupPickaxeRepo(t, when)
+	repo, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	commitFiles(t, dir, worktree, map[string]string{"b.go": "package b\n"}, "Add b.go", when.Add(4*time.Hour))
+	want := captureStdout(func() { runOwnership(ownershipCmd, []string{dir}) })
+
+	// Remove every commit but HEAD, so that walking history fails
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	commits, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	assert.NoError(t, err)
+	assert.NoError(t, commits.ForEach(func(c *object.Commit) error {
+		if c.Hash == head.Hash() {
+			return nil
+		}
+		hash := c.Hash.String()
+		return os.Remove(filepath.Join(dir, ".git", "objects", hash[:2], hash[2:]))
+	}))
+
+	// A warm run at the same revision finds what the last one did
+	assert.Equal(t, want, captureStdout(func() { runOwnership(ownershipCmd, []string{dir}) }))
+
+	// A run at a later revision only walks back to it, though blaming the
+	// files changed since still needs their history
+	commitFiles(t, dir, worktree, map[string]string{"b.go": "package b\n\nfunc B() {}\n"}, "Change b.go", when.Add(5*time.Hour))
+	newHead, err := repo.Head()
+	assert.NoError(t, err)
+	commit, err := repo.CommitObject(newHead.Hash())
+	assert.NoError(t, err)
+	store, err := openCacheStore()
+	assert.NoError(t, err)
+	last, err := lastChanges(store, commit, []string{"api.go", "b.go"})
+	assert.NoError(t, err)
+	headCommit, err := repo.CommitObject(head.Hash())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]plumbing.Hash{
+		"api.go": headCommit.ParentHashes[0],
+		"b.go":   newHead.Hash(),
+	}, last)
+}
+
+func TestOwnershipDir(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		depth int
+		want  string
+	}{
+		{"main.go", 1, "./"},
+		{"cmd/root.go", 1, "cmd/"},
+		{"a/b/c/d.go", 1, "a/"},
+		{"a/b/c/d.go", 2, "a/b/"},
+		{"a/b/c/d.go", 5, "a/b/c/"},
+	} {
+		assert.Equal(t, tc.want, ownershipDir(tc.name, tc.depth), "%s at depth %d", tc.name, tc.depth)
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/spf13/cobra"
+)
+
+var noPager bool
+
+// noPagerAnnotation marks commands whose output is never paged, such as
+// long-running ones
+const noPagerAnnotation = "grit/no-pager"
+
+// pager is a process paging stdout
+type pager struct {
+	cmd      *exec.Cmd
+	w        *os.File // pipe to the pager, standing in for stdout
+	terminal *os.File // stdout before the pager took it over
+}
+
+// activePager is the pager stdout is going through, if any
+var activePager *pager
+
+// pagerCommand returns the command to page output with: $GRIT_PAGER, git's
+// core.pager, $PAGER, or less. An empty command or "cat" means no paging.
+func pagerCommand() string {
+	if command, ok := os.LookupEnv("GRIT_PAGER"); ok {
+		return command
+	}
+	if command, ok := gitPagerConfig(); ok {
+		return command
+	}
+	if command, ok := os.LookupEnv("PAGER"); ok {
+		return command
+	}
+	return "less"
+}
+
+// gitPagerConfig returns core.pager from the repository in the current
+// directory, if any, or else from the user's git config
+func gitPagerConfig() (string, bool) {
+	if repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true}); err == nil {
+		if cfg, err := repo.Config(); err == nil && cfg.Raw.Section("core").HasOption("pager") {
+			return cfg.Raw.Section("core").Option("pager"), true
+		}
+	}
+	if cfg, err := config.LoadConfig(config.GlobalScope); err == nil && cfg.Raw.Section("core").HasOption("pager") {
+		return cfg.Raw.Section("core").Option("pager"), true
+	}
+	return "", false
+}
+
+// startPager sends stdout through the pager if it is a terminal and the
+// command's output may be paged. Failing to start the pager is not an error:
+// output just goes straight to the terminal.
+func startPager(cmd *cobra.Command) {
+	if noPager || cmd.Annotations[noPagerAnnotation] != "" || !isTerminal(os.Stdout) {
+		return
+	}
+	command := strings.TrimSpace(pagerCommand())
+	if command == "" || command == "cat" {
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	p := &pager{cmd: shellCommand(command), w: w, terminal: os.Stdout}
+	p.cmd.Stdin = r
+	p.cmd.Stdout = os.Stdout
+	p.cmd.Stderr = os.Stderr
+	// As git does: quit if everything fits on one screen, pass colours
+	// through, and don't clear the screen on exit
+	p.cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		p.cmd.Env = append(p.cmd.Env, "LESS=FRX")
+	}
+	if _, ok := os.LookupEnv("LV"); !ok {
+		p.cmd.Env = append(p.cmd.Env, "LV=-c")
+	}
+	if err := p.cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return
+	}
+	r.Close()
+
+	os.Stdout = w
+	activePager = p
+}
+
+// stopPager waits for the reader to finish with the pager and gives stdout
+// back to the terminal
+func stopPager() {
+	p := activePager
+	if p == nil {
+		return
+	}
+	p.w.Close()
+	p.cmd.Wait()
+	os.Stdout = p.terminal
+	activePager = nil
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalStdout returns the file output is ultimately shown on: the
+// terminal behind the pager, or stdout
+func terminalStdout() *os.File {
+	if activePager != nil {
+		return activePager.terminal
+	}
+	return os.Stdout
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand runs a command line the way the user's shell would, so pagers
+// can be given with arguments, as in git
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// brokenPipe reports whether err is from writing to a pipe nothing reads any
+// more, as when the reader quits the pager
+func brokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package cmd
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand runs a command line the way the user's shell would
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// errorNoData is ERROR_NO_DATA, which writing to a pipe whose reader has
+// closed it returns; package syscall doesn't name it
+const errorNoData = syscall.Errno(232)
+
+// brokenPipe reports whether err is from writing to a pipe nothing reads any
+// more, as when the reader quits the pager
+func brokenPipe(err error) bool {
+	return errors.Is(err, syscall.ERROR_BROKEN_PIPE) || errors.Is(err, errorNoData)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	pickaxeString string
+	pickaxeRegex  string
+)
+
+// pickaxe finds the changes to a file that add or remove a string (-S) or
+// lines matching a regex (-G), like git log's pickaxe options
+type pickaxe struct {
+	str string
+	re  *regexp.Regexp
+}
+
+// newPickaxe compiles the pickaxe in args, returning nil if none was given
+func newPickaxe(a CacheArgs) (*pickaxe, error) {
+	switch {
+	case a.Pickaxe != "" && a.PickaxeRegex != "":
+		return nil, fmt.Errorf("-S and -G can't be combined")
+	case a.Pickaxe != "":
+		return &pickaxe{str: a.Pickaxe}, nil
+	case a.PickaxeRegex != "":
+		re, err := regexp.Compile(a.PickaxeRegex)
+		if err != nil {
+			return nil, fmt.Errorf("compiling pickaxe regex pattern: %w", err)
+		}
+		return &pickaxe{re: re}, nil
+	}
+	return nil, nil
+}
+
+// matches reports whether a line contains the string or matches the regex
+func (p *pickaxe) matches(line string) bool {
+	if p.re != nil {
+		return p.re.MatchString(line)
+	}
+	return strings.Contains(line, p.str)
+}
+
+// changes returns, for each file of a commit's diff against its first parent
+// that the pickaxe picks out, how many added and removed lines matched. With
+// -S a file is picked out if the number of occurrences of the string changed;
+// with -G if any added or removed line matched. Only files for which keep
+// returns true are examined.
+func (p *pickaxe) changes(c *object.Commit, keep func(name string) bool) (object.FileStats, error) {
+	patch, err := firstParentPatch(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats object.FileStats
+	for _, fp := range patch.FilePatches() {
+		if fp.IsBinary() {
+			continue
+		}
+		from, to := fp.Files()
+		var name string
+		if to != nil {
+			name = to.Path()
+		} else {
+			name = from.Path()
+		}
+		if !keep(name) {
+			continue
+		}
+
+		stat := object.FileStat{Name: name}
+		var added, removed int
+		for _, chunk := range fp.Chunks() {
+			if chunk.Type() == diff.Equal {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(chunk.Content(), "\n"), "\n") {
+				if chunk.Type() == diff.Add {
+					added += strings.Count(line, p.str)
+				} else {
+					removed += strings.Count(line, p.str)
+				}
+				if !p.matches(line) {
+					continue
+				}
+				if chunk.Type() == diff.Add {
+					stat.Addition++
+				} else {
+					stat.Deletion++
+				}
+			}
+		}
+
+		picked := stat.Addition+stat.Deletion > 0
+		if p.re == nil {
+			// Moving an occurrence within the file doesn't add or remove it
+			picked = added != removed
+		}
+		if picked {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+var maxLatency time.Duration
+
+// refreshTimeout is how long a background refresh may run before another
+// one is allowed to start in its place
+const refreshTimeout = 10 * time.Minute
+
+// startRefreshFn starts the process that recomputes a stale result
+var startRefreshFn = startDetachedRefresh
+
+// refreshInBackground starts recomputing a stale result in a detached process,
+// unless a refresh for the same key is already running. Failures are ignored:
+// the stale result has been served and the next run will try again.
+func refreshInBackground(key string) {
+	claimed, err := claimRefresh(key)
+	if err != nil || !claimed {
+		return
+	}
+	if err := startRefreshFn(); err != nil {
+		finishRefresh(key)
+	}
+}
+
+// startDetachedRefresh re-runs the current command without a latency limit,
+// detached from the terminal so that it outlives this process
+func startDetachedRefresh() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// The last occurrence of a flag wins, so this overrides --max-latency. It
+	// goes before any "--", after which everything is a pathspec.
+	args := append([]string{}, os.Args[1:]...)
+	dash := len(args)
+	for i, arg := range args {
+		if arg == "--" {
+			dash = i
+			break
+		}
+	}
+	args = append(args[:dash], append([]string{"--max-latency=0"}, args[dash:]...)...)
+	cmd := exec.Command(executable, args...)
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// refreshMarkerPath returns the file that marks a refresh of key as running
+func refreshMarkerPath(key string) (string, error) {
+	dir, err := getCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "refresh", key), nil
+}
+
+// claimRefresh atomically marks a refresh of key as running. It returns false
+// if another refresh already holds the marker and has not timed out.
+func claimRefresh(key string) (bool, error) {
+	path, err := refreshMarkerPath(key)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			return true, f.Close()
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+
+		// Take over from a refresh that died without cleaning up
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < refreshTimeout {
+			return false, nil
+		}
+		os.Remove(path)
+	}
+	return false, nil
+}
+
+// finishRefresh clears the marker for a refresh of key
+func finishRefresh(key string) {
+	if path, err := refreshMarkerPath(key); err == nil {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimRefresh(t *testing.T) {
+	tempDir := t.TempDir()
+	originalGetCacheDir := getCacheDirFn
+	getCacheDirFn = func() (string, error) {
+		return tempDir, nil
+	}
+	defer func() { getCacheDirFn = originalGetCacheDir }()
+
+	claimed, err := claimRefresh("key")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// A second claim fails while the first refresh is running
+	claimed, err = claimRefresh("key")
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	// Other keys are independent
+	claimed, err = claimRefresh("other")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// A finished refresh releases the claim
+	finishRefresh("key")
+	claimed, err = claimRefresh("key")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// A refresh that died without cleaning up is taken over
+	marker, err := refreshMarkerPath("key")
+	assert.NoError(t, err)
+	old := time.Now().Add(-2 * refreshTimeout)
+	assert.NoError(t, os.Chtimes(marker, old, old))
+	claimed, err = claimRefresh("key")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+}
+
+func TestRunLinesMaxLatency(t *testing.T) {
+	repoDir, _ := setupCacheCmdTest(t)
+
+	var refreshes int
+	originalStartRefresh := startRefreshFn
+	startRefreshFn = func() error {
+		refreshes++
+		return nil
+	}
+	defer func() {
+		startRefreshFn = originalStartRefresh
+		maxLatency = 0
+		noCache = false
+	}()
+
+	authorRegex = ""
+	remoteName = ""
+	filenamesRegex = ""
+	weekToDate = false
+	noCache = false
+	maxLatency = 0
+
+	// Cache a result, then make it stale by adding a commit
+	assert.Equal(t, "+2/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+
+	repo, err := git.PlainOpen(repoDir)
+	assert.NoError(t, err)
+	w, err := repo.Worktree()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("one\ntwo\nthree\n"), 0644))
+	_, err = w.Add("test.txt")
+	assert.NoError(t, err)
+	_, err = w.Commit("Second commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test Author", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	// A fresh result that can't be computed in time is served stale, and
+	// repeated runs don't start more refreshes
+	maxLatency = time.Nanosecond
+	assert.Equal(t, "+2/-0*", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	assert.Equal(t, "+2/-0*", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	assert.Equal(t, 1, refreshes)
+
+	// A fresh result that arrives in time is printed and cached, and clears
+	// the refresh marker
+	maxLatency = time.Minute
+	assert.Equal(t, "+3/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	marker, err := refreshMarkerPath(cacheKey([]string{repoDir}, flagArgs()))
+	assert.NoError(t, err)
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+
+	// The refreshed result is now served from the cache
+	maxLatency = time.Nanosecond
+	assert.Equal(t, "+3/-0", captureStdout(func() { runLines(nil, []string{repoDir}) }))
+	assert.Equal(t, 1, refreshes)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// revisionSpec is a repository path with an optional branch or revision,
+// written on the command line as path[@branch]
+type revisionSpec struct {
+	Path   string
+	Branch string
+}
+
+// parseRevisionSpec splits a path[@branch] argument
+func parseRevisionSpec(spec string) revisionSpec {
+	if idx := strings.LastIndex(spec, "@"); idx != -1 {
+		return revisionSpec{Path: spec[:idx], Branch: spec[idx+1:]}
+	}
+	return revisionSpec{Path: spec}
+}
+
+// String formats the spec as it is written on the command line
+func (s revisionSpec) String() string {
+	if s.Branch == "" {
+		return s.Path
+	}
+	return s.Path + "@" + s.Branch
+}
+
+// resolve returns the commit a spec points at in an opened repository: HEAD
+// when no branch is given, the branch on the given remote if one is set, or
+// otherwise the local branch. Without a remote, anything else git accepts as
+// a revision (a tag, a hash) is tried last.
+//
+// Both counting and cache validation resolve specs through here, so a cached
+// result is always checked against the commit it was computed from.
+func (s revisionSpec) resolve(repo *git.Repository, remote string) (*plumbing.Reference, error) {
+	if s.Branch == "" {
+		return repo.Head()
+	}
+
+	if remote != "" {
+		return repo.Reference(plumbing.NewRemoteReferenceName(remote, s.Branch), true)
+	}
+
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(s.Branch), true)
+	if err == nil {
+		return ref, nil
+	}
+	hash, revErr := repo.ResolveRevision(plumbing.Revision(s.Branch))
+	if revErr != nil {
+		return nil, err
+	}
+	return plumbing.NewHashReference(plumbing.ReferenceName(s.Branch), *hash), nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevisionSpec(t *testing.T) {
+	assert.Equal(t, revisionSpec{Path: "./"}, parseRevisionSpec("./"))
+	assert.Equal(t, revisionSpec{Path: "./", Branch: "main"}, parseRevisionSpec("./@main"))
+	assert.Equal(t, revisionSpec{Path: "/tmp/a@b", Branch: "main"}, parseRevisionSpec("/tmp/a@b@main"))
+
+	dir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	repo, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	feature, err := repo.Reference(plumbing.NewBranchReferenceName("feature"), true)
+	assert.NoError(t, err)
+
+	ref, err := revisionSpec{Path: dir}.resolve(repo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, head.Hash(), ref.Hash())
+
+	ref, err = revisionSpec{Path: dir, Branch: "feature"}.resolve(repo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, feature.Hash(), ref.Hash())
+
+	// Tags and hashes resolve as revisions
+	_, err = repo.CreateTag("v1.0", feature.Hash(), nil)
+	assert.NoError(t, err)
+	ref, err = revisionSpec{Path: dir, Branch: "v1.0"}.resolve(repo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, feature.Hash(), ref.Hash())
+
+	ref, err = revisionSpec{Path: dir, Branch: feature.Hash().String()}.resolve(repo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, feature.Hash(), ref.Hash())
+
+	_, err = revisionSpec{Path: dir, Branch: "missing"}.resolve(repo, "")
+	assert.Error(t, err)
+
+	// With a remote, only the remote branch is considered
+	_, err = revisionSpec{Path: dir, Branch: "feature"}.resolve(repo, "origin")
+	assert.Error(t, err)
+}
@@ -5,12 +5,27 @@ import "github.com/spf13/cobra"
 var rootCmd = &cobra.Command{
 	Use:   "grit",
 	Short: "Git repository inspection tool",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateColorMode(colorMode); err != nil {
+			return err
+		}
+		startPager(cmd)
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
 }
 
-// Execute executes the root command
+func init() {
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", "auto", "Colour output: auto (when writing to a terminal and NO_COLOR is unset), always or never")
+	rootCmd.PersistentFlags().BoolVar(&noPager, "no-pager", false, "Don't page output through $GRIT_PAGER, git's core.pager, $PAGER or less when writing to a terminal")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Directory to keep the results cache in (default $GRIT_CACHE_DIR, or grit in the user cache directory)")
+}
+
+// Execute executes the root command, waiting for the pager, if one was
+// started, to be closed
 func Execute() error {
+	defer stopPager()
 	return rootCmd.Execute()
 }
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"bytes"
+	"os"
 	"testing"
 
+	"github.com/go-git/go-git/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,3 +24,68 @@ func TestRootCommand(t *testing.T) {
 	assert.Contains(t, output, "count")
 	assert.Contains(t, output, "log")
 }
+
+func TestLogStopsWhenPagerQuits(t *testing.T) {
+	// A pager that has quit leaves a pipe nothing reads
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	r.Close()
+	defer w.Close()
+
+	entry := &logEntry{Hash: "0123456789abcdef", ShortHash: "0123456", Subject: "Subject"}
+	printer, err := newLogPrinter(w, "oneline", "")
+	assert.NoError(t, err)
+	err = printer.print(entry)
+	assert.True(t, brokenPipe(err), "got %v", err)
+
+	printer.graph = &logGraph{}
+	err = printer.print(entry)
+	assert.True(t, brokenPipe(err), "got %v", err)
+
+	assert.False(t, brokenPipe(nil))
+	assert.False(t, brokenPipe(os.ErrClosed))
+}
+
+func TestPagerCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+
+	// less unless something else is configured
+	os.Unsetenv("GRIT_PAGER")
+	os.Unsetenv("PAGER")
+	assert.Equal(t, "less", pagerCommand())
+
+	t.Setenv("PAGER", "more")
+	assert.Equal(t, "more", pagerCommand())
+
+	// git's core.pager takes precedence over $PAGER
+	repo, err := git.PlainInit(".", false)
+	assert.NoError(t, err)
+	cfg, err := repo.Config()
+	assert.NoError(t, err)
+	cfg.Raw.Section("core").SetOption("pager", "less -S")
+	assert.NoError(t, repo.SetConfig(cfg))
+	assert.Equal(t, "less -S", pagerCommand())
+
+	// $GRIT_PAGER takes precedence over everything, even when empty
+	t.Setenv("GRIT_PAGER", "")
+	assert.Equal(t, "", pagerCommand())
+}
+
+func TestRootColorFlag(t *testing.T) {
+	defer func() { colorMode = "auto" }()
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	rootCmd.SetArgs([]string{"--color", "sometimes", "log"})
+	err := rootCmd.Execute()
+	assert.EqualError(t, err, `invalid color mode "sometimes" (must be auto, always or never)`)
+
+	// Output that isn't a terminal is neither paged nor coloured
+	colorMode = "auto"
+	rootCmd.SetArgs([]string{})
+	assert.NoError(t, rootCmd.Execute())
+	assert.Nil(t, activePager)
+	assert.False(t, colorEnabled())
+}
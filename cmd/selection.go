@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+// commitSelection decides which commits, and which of their files, count
+// lines counts and log lists, so the two commands always agree
+type commitSelection struct {
+	filter     *commitFilter
+	filenameRe *regexp.Regexp
+	pathspecs  []string
+	dateField  string
+	since      time.Time // commits dated before this are skipped; zero for no limit
+	skipMerges bool
+	pickaxe    *pickaxe
+	// pickaxeCounts counts only the lines the pickaxe matched, rather than
+	// every line changed in the files it picked out
+	pickaxeCounts bool
+	follow        *fileFollower // the one file whose changes are selected, with --follow
+	stats         func(c *object.Commit) (object.FileStats, error)
+}
+
+// selectedCommit is a commit chosen by a commitSelection
+type selectedCommit struct {
+	*object.Commit
+	Credits []credit         // contributors who passed the filters
+	Files   object.FileStats // changes to the selected files only
+}
+
+// newCommitSelection compiles the filters in args. Commits are not limited
+// by date and merges are included until since and skipMerges are set.
+func newCommitSelection(a CacheArgs) (*commitSelection, error) {
+	s := &commitSelection{
+		dateField: a.DateField,
+		stats:     (*object.Commit).Stats,
+	}
+
+	var err error
+	s.filter, err = newCommitFilter(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.FilenamesRegex != "" {
+		s.filenameRe, err = regexp.Compile(a.FilenamesRegex)
+		if err != nil {
+			return nil, fmt.Errorf("compiling filename regex pattern: %w", err)
+		}
+	}
+
+	for _, pathspec := range a.Pathspecs {
+		pathspec = strings.Trim(path.Clean(filepath.ToSlash(pathspec)), "/")
+		if _, err := path.Match(pathspec, ""); err != nil {
+			return nil, fmt.Errorf("invalid pathspec %q: %w", pathspec, err)
+		}
+		s.pathspecs = append(s.pathspecs, pathspec)
+	}
+
+	s.pickaxe, err = newPickaxe(a)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Follow != "" {
+		if len(a.Pathspecs) > 0 {
+			return nil, fmt.Errorf("--follow can't be combined with pathspecs")
+		}
+		s.follow = newFileFollower(strings.Trim(path.Clean(filepath.ToSlash(a.Follow)), "/"))
+	}
+
+	return s, nil
+}
+
+// selectCommit returns the commit with its credits and selected files, or
+// nil if it is not selected
+func (s *commitSelection) selectCommit(c *object.Commit) (*selectedCommit, error) {
+	// A followed file is traced through every commit, so that renames in
+	// commits that aren't selected are still seen
+	var followed object.FileStats
+	if s.follow != nil {
+		var err error
+		if followed, err = s.follow.stats(c); err != nil || followed == nil {
+			return nil, err
+		}
+	}
+
+	if !s.since.IsZero() && commitDate(c, s.dateField).Before(s.since) {
+		return nil, nil
+	}
+
+	// Merge commits repeat the changes of the branch they merge
+	if s.skipMerges && len(c.ParentHashes) > 1 {
+		return nil, nil
+	}
+
+	credits := s.filter.credits(c)
+	if len(credits) == 0 {
+		return nil, nil
+	}
+
+	stats := followed
+	if s.follow == nil {
+		var err error
+		if stats, err = s.stats(c); err != nil {
+			return nil, err
+		}
+	}
+
+	filesFiltered := s.filenameRe != nil || len(s.pathspecs) > 0
+	if !filesFiltered && s.pickaxe == nil {
+		return &selectedCommit{Commit: c, Credits: credits, Files: stats}, nil
+	}
+
+	var files object.FileStats
+	for _, stat := range stats {
+		if s.selectsFile(stat.Name) {
+			files = append(files, stat)
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	if s.pickaxe != nil {
+		var err error
+		if files, err = s.pickaxeFiles(c, files); err != nil || len(files) == 0 {
+			return nil, err
+		}
+	}
+	return &selectedCommit{Commit: c, Credits: credits, Files: files}, nil
+}
+
+// pickaxeFiles narrows a commit's selected files to those the pickaxe picks
+// out, with either their whole changes or just the matching lines
+func (s *commitSelection) pickaxeFiles(c *object.Commit, files object.FileStats) (object.FileStats, error) {
+	picked, err := s.pickaxe.changes(c, s.selectsFile)
+	if err != nil || s.pickaxeCounts {
+		return picked, err
+	}
+
+	var narrowed object.FileStats
+	for _, stat := range files {
+		for _, p := range picked {
+			if p.Name == stat.Name {
+				narrowed = append(narrowed, stat)
+				break
+			}
+		}
+	}
+	return narrowed, nil
+}
+
+// startHistory prepares to read the history of another repository
+func (s *commitSelection) startHistory() {
+	if s.follow != nil {
+		s.follow.reset()
+	}
+}
+
+// selectsFile reports whether a file passes --filenames-regex and the pathspecs
+func (s *commitSelection) selectsFile(name string) bool {
+	if s.filenameRe != nil && !s.filenameRe.MatchString(name) {
+		return false
+	}
+	if len(s.pathspecs) == 0 {
+		return true
+	}
+	for _, pathspec := range s.pathspecs {
+		if pathspecMatches(pathspec, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathspecMatches reports whether a file, named relative to the repository
+// root, is the pathspec, lies under it, or matches it as a glob
+func pathspecMatches(pathspec, name string) bool {
+	if pathspec == "." || pathspec == name || strings.HasPrefix(name, pathspec+"/") {
+		return true
+	}
+	matched, _ := path.Match(pathspec, name)
+	return matched
+}
+
+// totals returns the lines added and deleted in the selected files
+func (sc *selectedCommit) totals() (int64, int64) {
+	var added, deleted int64
+	for _, stat := range sc.Files {
+		added += int64(stat.Addition)
+		deleted += int64(stat.Deletion)
+	}
+	return added, deleted
+}
+
+// splitPathspecs separates repository paths from the pathspecs given after "--"
+func splitPathspecs(cmd *cobra.Command, args []string) ([]string, []string) {
+	if cmd == nil {
+		return args, nil
+	}
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		return args[:dash], args[dash:]
+	}
+	return args, nil
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	shortlogSort    string
+	shortlogReverse bool
+	shortlogCmd     = &cobra.Command{
+		Use:   "shortlog [paths...] [-- pathspec...]",
+		Short: "Summarise commits and lines changed per author",
+		Long: `Summarise, like git shortlog -sne, the commits of every author in the
+repositories at paths, each optionally followed by @branch: how many commits
+they made, the lines they added and removed, the dates of their first and last
+commits and the number of days they committed on.
+
+Commits are chosen exactly as count lines chooses them, over the same current
+day or week, so each author's lines add up to count lines --by author. Authors
+are combined across repositories, and each repository's .mailmap is honoured.`,
+		Run: runShortlog,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(shortlogCmd)
+	addFilterFlags(shortlogCmd)
+	shortlogCmd.Flags().StringVarP(&remoteName, "remote", "r", "", "Remote name to use for branch references")
+	shortlogCmd.Flags().StringVarP(&filenamesRegex, "filenames-regex", "f", "", "Only count files matching this regex")
+	shortlogCmd.Flags().BoolVarP(&weekToDate, "week-to-date", "w", false, "Summarise commits from the start of the current week (Monday) instead of the current day")
+	shortlogCmd.Flags().StringVar(&dateField, "date-field", "author", "Commit date to filter and summarise on: author (written) or committer (landed)")
+	shortlogCmd.Flags().StringVar(&followFile, "follow", "", "Summarise the changes to this one file over its whole history, following it across renames")
+	shortlogCmd.Flags().BoolVarP(&noCache, "no-cache", "n", false, "Don't read or save per-commit stats in the cache")
+	shortlogCmd.Flags().StringVarP(&shortlogSort, "sort", "s", "commits", "Column to sort by: author, commits, added, deleted, first, last or days")
+	shortlogCmd.Flags().BoolVar(&shortlogReverse, "reverse", false, "Reverse the sort order")
+}
+
+// authorSummary is an author's activity, as shown by grit shortlog
+type authorSummary struct {
+	Author  string
+	Commits int
+	Added   int64
+	Deleted int64
+	First   time.Time
+	Last    time.Time
+	days    map[string]bool // dates committed on, in the commits' own time zones
+}
+
+// add counts a commit, or the author's share of one, made at when
+func (s *authorSummary) add(when time.Time, added, deleted int64) {
+	s.Commits++
+	s.Added += added
+	s.Deleted += deleted
+	if s.First.IsZero() || when.Before(s.First) {
+		s.First = when
+	}
+	if when.After(s.Last) {
+		s.Last = when
+	}
+	s.days[when.Format(time.DateOnly)] = true
+}
+
+// Days returns the number of days the author committed on
+func (s *authorSummary) Days() int {
+	return len(s.days)
+}
+
+// shortlogLess orders summaries by a column: authors alphabetically, first
+// commits earliest first and everything else largest or latest first
+var shortlogLess = map[string]func(a, b *authorSummary) bool{
+	"author":  func(a, b *authorSummary) bool { return a.Author < b.Author },
+	"commits": func(a, b *authorSummary) bool { return a.Commits > b.Commits },
+	"added":   func(a, b *authorSummary) bool { return a.Added > b.Added },
+	"deleted": func(a, b *authorSummary) bool { return a.Deleted > b.Deleted },
+	"first":   func(a, b *authorSummary) bool { return a.First.Before(b.First) },
+	"last":    func(a, b *authorSummary) bool { return a.Last.After(b.Last) },
+	"days":    func(a, b *authorSummary) bool { return a.Days() > b.Days() },
+}
+
+// validateShortlogSort checks a --sort column
+func validateShortlogSort(column string) error {
+	if _, ok := shortlogLess[column]; !ok {
+		return fmt.Errorf("invalid sort column %q (must be author, commits, added, deleted, first, last or days)", column)
+	}
+	return nil
+}
+
+func runShortlog(cmd *cobra.Command, args []string) {
+	args, pathspecs := splitPathspecs(cmd, args)
+	if len(args) == 0 {
+		args = []string{"./"}
+	}
+
+	if err := validateDateField(dateField); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if err := validateShortlogSort(shortlogSort); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	shortlogArgs := flagArgs()
+	shortlogArgs.Pathspecs = pathspecs
+	selection, err := newCommitSelection(shortlogArgs)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	// Count commits and lines exactly as count lines does
+	selection.skipMerges = true
+	selection.pickaxeCounts = true
+	if followFile == "" {
+		selection.since, _ = countWindow(timeNow(), weekToDate)
+	}
+	if !noCache {
+		if store, err := openCacheStore(); err == nil {
+			selection.stats = cachedCommitStats(store)
+		}
+	}
+
+	summaries := make(map[string]*authorSummary)
+	for _, pathSpec := range args {
+		repo, commits := openLog(pathSpec, defaultOrder)
+		if commits == nil {
+			continue
+		}
+
+		var tip *object.Commit
+		spec := parseRevisionSpec(pathSpec)
+		if ref, err := spec.resolve(repo, remoteName); err == nil {
+			tip, _ = repo.CommitObject(ref.Hash())
+		}
+		mailmap := readMailmap(repo, spec.Path, tip)
+
+		selection.startHistory()
+		err := commits.ForEach(func(c *object.Commit) error {
+			sc, err := selection.selectCommit(c)
+			if err != nil || sc == nil {
+				return err
+			}
+			added, deleted := sc.totals()
+			when := commitDate(c, dateField)
+			for _, cr := range sc.Credits {
+				key := authorKey(mailmap.resolve(cr.Signature))
+				summary, ok := summaries[key]
+				if !ok {
+					summary = &authorSummary{Author: key, days: make(map[string]bool)}
+					summaries[key] = summary
+				}
+				summary.add(when, cr.share(added), cr.share(deleted))
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error processing commits for repository at %s: %v\n", spec.Path, err)
+		}
+	}
+
+	printShortlog(sortShortlog(summaries, shortlogSort, shortlogReverse))
+}
+
+// sortShortlog orders the summaries by a column, breaking ties by author
+func sortShortlog(summaries map[string]*authorSummary, column string, reverse bool) []*authorSummary {
+	sorted := make([]*authorSummary, 0, len(summaries))
+	for _, s := range summaries {
+		sorted = append(sorted, s)
+	}
+	less := shortlogLess[column]
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if reverse {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.Author < b.Author
+	})
+	return sorted
+}
+
+// printShortlog writes the summaries as a table
+func printShortlog(summaries []*authorSummary) {
+	columns := []tableColumn{
+		{header: "Commits", right: true},
+		{header: "Added", color: colorGreen, right: true},
+		{header: "Deleted", color: colorRed, right: true},
+		{header: "First"},
+		{header: "Last"},
+		{header: "Days", right: true},
+		{header: "Author", color: colorCyan},
+	}
+	rows := make([][]string, 0, len(summaries))
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			strconv.Itoa(s.Commits),
+			fmt.Sprintf("+%d", s.Added),
+			fmt.Sprintf("-%d", s.Deleted),
+			s.First.Format(time.DateOnly),
+			s.Last.Format(time.DateOnly),
+			strconv.Itoa(s.Days()),
+			s.Author,
+		})
+	}
+	writeTable(os.Stdout, columns, rows, colorEnabled())
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunShortlog(t *testing.T) {
+	// Thursday, March 7, 2024 at 12:00:00 UTC
+	referenceTime := time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return referenceTime }
+	defer func() {
+		timeNow = time.Now
+		noCache = false
+		weekToDate = false
+		shortlogSort = "commits"
+		shortlogReverse = false
+	}()
+	noCache = true
+	weekToDate = true
+
+	// Alice, Bob and Carol commit in both repositories, from Monday on
+	dirs := []string{
+		setupRenameRepo(t, referenceTime.AddDate(0, 0, -3).Add(-3*time.Hour)),
+		setupPickaxeRepo(t, referenceTime.Add(-3*time.Hour)),
+	}
+	mailmap := "# Canonical identities\nAlice Smith <alice@example.com>\nRobert <robert@example.com> <bob@example.com>\n"
+	for _, dir := range dirs {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, mailmapFileName), []byte(mailmap), 0644))
+	}
+
+	output := captureStdout(func() { runShortlog(nil, dirs) })
+	assert.Equal(t, ""+
+		"Commits  Added  Deleted  First       Last        Days  Author\n"+
+		"      3    +15       -0  2024-03-04  2024-03-07     2  Alice Smith <alice@example.com>\n"+
+		"      2     +2       -1  2024-03-06  2024-03-07     2  Carol <carol@example.com>\n"+
+		"      2     +2       -2  2024-03-05  2024-03-07     2  Robert <robert@example.com>\n", output)
+
+	authors := func(output string) []string {
+		var names []string
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n")[1:] {
+			names = append(names, strings.Fields(line)[6])
+		}
+		return names
+	}
+
+	shortlogSort = "deleted"
+	assert.Equal(t, []string{"Robert", "Carol", "Alice"}, authors(captureStdout(func() { runShortlog(nil, dirs) })))
+
+	shortlogSort = "author"
+	shortlogReverse = true
+	assert.Equal(t, []string{"Robert", "Carol", "Alice"}, authors(captureStdout(func() { runShortlog(nil, dirs) })))
+
+	// The current day only, as with count lines
+	weekToDate = false
+	shortlogSort = "commits"
+	shortlogReverse = false
+	assert.Equal(t, []string{"Alice", "Carol", "Robert"}, authors(captureStdout(func() { runShortlog(nil, dirs[1:]) })))
+
+	shortlogSort = "size"
+	assert.Equal(t, "Error: invalid sort column \"size\" (must be author, commits, added, deleted, first, last or days)\n",
+		captureStdout(func() { runShortlog(nil, dirs) }))
+}
+
+func TestMailmap(t *testing.T) {
+	m, err := parseMailmap(strings.NewReader(`
+# Comments and blank lines are ignored
+
+Jane Doe <jane@example.com>
+<jane@example.com> <jane@old.example.com>
+Joe Bloggs <joe@example.com> <joe@laptop.local>
+Joe Bloggs <joe@example.com> Work Joe <shared@example.com>
+`))
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name, email         string
+		wantName, wantEmail string
+	}{
+		{"jane", "jane@example.com", "Jane Doe", "jane@example.com"},
+		{"Jane D", "JANE@old.example.com", "Jane D", "jane@example.com"},
+		{"joe", "joe@laptop.local", "Joe Bloggs", "joe@example.com"},
+		{"work joe", "shared@example.com", "Joe Bloggs", "joe@example.com"},
+		{"Someone Else", "shared@example.com", "Someone Else", "shared@example.com"},
+		{"Unknown", "unknown@example.com", "Unknown", "unknown@example.com"},
+	} {
+		got := m.resolve(object.Signature{Name: tc.name, Email: tc.email})
+		assert.Equal(t, tc.wantName, got.Name, "%s <%s>", tc.name, tc.email)
+		assert.Equal(t, tc.wantEmail, got.Email, "%s <%s>", tc.name, tc.email)
+	}
+}
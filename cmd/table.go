@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// tableColumn describes a column of a table written by writeTable
+type tableColumn struct {
+	header string
+	color  string // ANSI colour of the column's cells, if any
+	right  bool   // right-align, as for numbers
+}
+
+// writeTable writes rows of cells under a header, in aligned columns two
+// spaces apart. Cells are padded before they are coloured, so colour codes
+// don't upset the alignment as they do with text/tabwriter.
+func writeTable(w io.Writer, columns []tableColumn, rows [][]string, color bool) {
+	widths := make([]int, len(columns))
+	for i, c := range columns {
+		widths[i] = utf8.RuneCountInString(c.header)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	line := func(cells []string, colored bool) {
+		parts := make([]string, len(cells))
+		for i, cell := range cells {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if colored {
+				cell = colorize(cell, columns[i].color, color && columns[i].color != "")
+			}
+			if columns[i].right {
+				parts[i] = pad + cell
+			} else if i < len(cells)-1 {
+				parts[i] = cell + pad
+			} else {
+				parts[i] = cell
+			}
+		}
+		fmt.Fprintln(w, strings.Join(parts, "  "))
+	}
+
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = c.header
+	}
+	line(headers, false)
+	for _, row := range rows {
+		line(row, true)
+	}
+}